@@ -0,0 +1,543 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Methods in this file accumulate values into per-bin counts stored in the
+// Bin itself. Counts are int64 so that they do not wrap around on 32-bit
+// platforms when streaming large volumes of data. Accumulating modifies the
+// Bin and must not run concurrently with other accumulation; use
+// StreamingCounter for concurrent counting.
+
+// Accumulate counts value towards its bin and returns the bin number
+func (bin *Bin) Accumulate(value float64) int {
+	if bin.counts == nil {
+		bin.counts = make([]int64, len(bin.boundaries)+1)
+		bin.boundaryHits = make([]int64, len(bin.boundaries))
+	}
+
+	n := bin.Search(value)
+	bin.counts[n]++
+	if n > 0 && value <= bin.boundaries[n-1] {
+		// value lies on the lower boundary of its bin, or below it if the
+		// options moved it up
+		bin.boundaryHits[n-1]++
+	}
+	bin.cumulativeCounts.Store(nil)
+	return n
+}
+
+// Counts returns a copy of the accumulated counts, indexed by bin number
+func (bin *Bin) Counts() []int64 {
+	if bin.counts == nil {
+		return make([]int64, len(bin.boundaries)+1)
+	}
+	return append([]int64(nil), bin.counts...)
+}
+
+// CumulativeCount returns the number of accumulated values in the bins 0 to
+// binNumber inclusive, that is the number of values less than
+// Boundary(binNumber). The running totals are computed once after each
+// change, so repeated calls take constant time. CumulativeCount may be
+// called concurrently, but not concurrently with accumulation.
+func (bin *Bin) CumulativeCount(binNumber int) int64 {
+	if bin.counts == nil {
+		return 0
+	}
+
+	totals := bin.cumulativeCounts.Load()
+	if totals == nil {
+		// Concurrent callers may both compute the totals, but they agree
+		cumulative := make([]int64, len(bin.counts))
+		var total int64
+		for n, c := range bin.counts {
+			total += c
+			cumulative[n] = total
+		}
+		totals = &cumulative
+		bin.cumulativeCounts.Store(totals)
+	}
+	return (*totals)[binNumber]
+}
+
+// UnderflowCount returns the number of accumulated values left of the first
+// boundary
+func (bin *Bin) UnderflowCount() int64 {
+	if bin.counts == nil {
+		return 0
+	}
+	return bin.counts[0]
+}
+
+// OverflowCount returns the number of accumulated values at or right of the
+// last boundary. An empty Bin counts everything as underflow, so its
+// overflow is 0.
+func (bin *Bin) OverflowCount() int64 {
+	if bin.counts == nil || bin.empty {
+		return 0
+	}
+	return bin.counts[len(bin.boundaries)]
+}
+
+// splitCounts prepares the accumulated counts for inserting boundary at
+// index i. The count of the bin being split is divided proportionally to
+// the widths of both parts, assuming values are uniformly distributed
+// within the bin. Underflow and overflow have no width; inserting a
+// boundary outside of the proper bins creates an empty proper bin. Tracked
+// extremes of the split bin are forgotten.
+func (bin *Bin) splitCounts(i int, boundary float64) {
+	if bin.counts == nil {
+		return
+	}
+
+	// Bin i is split into the new bins i and i+1; frac is the share of the
+	// lower one
+	var frac float64
+	switch i {
+	case 0:
+		frac = 1
+	case len(bin.boundaries):
+		frac = 0
+	default:
+		lo, hi := bin.boundaries[i-1], bin.boundaries[i]
+		frac = (boundary - lo) / (hi - lo)
+	}
+	lower := int64(math.Round(float64(bin.counts[i]) * frac))
+	if i > 0 && lower < bin.boundaryHits[i-1] {
+		// Values on the lower boundary of the bin are known to be in the
+		// lower part
+		lower = bin.boundaryHits[i-1]
+	}
+	upper := bin.counts[i] - lower
+
+	counts := make([]int64, 0, len(bin.counts)+1)
+	counts = append(counts, bin.counts[:i]...)
+	counts = append(counts, lower, upper)
+	counts = append(counts, bin.counts[i+1:]...)
+	bin.counts = counts
+	bin.cumulativeCounts.Store(nil)
+
+	// Values exactly on the new boundary are not known
+	hits := make([]int64, 0, len(bin.boundaryHits)+1)
+	hits = append(hits, bin.boundaryHits[:i]...)
+	hits = append(hits, 0)
+	bin.boundaryHits = append(hits, bin.boundaryHits[i:]...)
+
+	if bin.weights != nil {
+		w := bin.weights[i]
+		bin.weights = splitFloats(bin.weights, i, w*frac)
+		bin.weights[i+1] = w - bin.weights[i]
+	}
+
+	if bin.binMin != nil {
+		// Which part the tracked extremes of the split bin are from is
+		// only known for one of them each, so forget both
+		bin.binMin = splitFloats(bin.binMin, i, math.NaN())
+		bin.binMax = splitFloats(bin.binMax, i, math.NaN())
+	}
+}
+
+// mergeCounts prepares the accumulated counts for removing the boundary at
+// index i by merging the bins i and i+1 into bin i
+func (bin *Bin) mergeCounts(i int) {
+	if bin.counts == nil {
+		return
+	}
+
+	counts := make([]int64, 0, len(bin.counts)-1)
+	counts = append(counts, bin.counts[:i]...)
+	counts = append(counts, bin.counts[i]+bin.counts[i+1])
+	counts = append(counts, bin.counts[i+2:]...)
+	bin.counts = counts
+	bin.cumulativeCounts.Store(nil)
+
+	// Values on the removed boundary are now inside bin i
+	hits := make([]int64, 0, len(bin.boundaryHits)-1)
+	hits = append(hits, bin.boundaryHits[:i]...)
+	bin.boundaryHits = append(hits, bin.boundaryHits[i+1:]...)
+
+	if bin.weights != nil {
+		bin.weights = mergeFloats(bin.weights, i, bin.weights[i]+bin.weights[i+1])
+	}
+
+	if bin.binMin != nil {
+		// math.Min and math.Max propagate NaN, the marker for no tracked
+		// value, so pick by hand
+		lo, hi := bin.binMin[i], bin.binMax[i]
+		if m := bin.binMin[i+1]; math.IsNaN(lo) || m < lo {
+			lo = m
+		}
+		if m := bin.binMax[i+1]; math.IsNaN(hi) || m > hi {
+			hi = m
+		}
+		bin.binMin = mergeFloats(bin.binMin, i, lo)
+		bin.binMax = mergeFloats(bin.binMax, i, hi)
+	}
+}
+
+// mergeFloats replaces s[i] and s[i+1] by a single entry of value
+func mergeFloats(s []float64, i int, value float64) []float64 {
+	merged := make([]float64, 0, len(s)-1)
+	merged = append(merged, s[:i]...)
+	merged = append(merged, value)
+	return append(merged, s[i+2:]...)
+}
+
+// splitFloats replaces s[i] by two entries of value
+func splitFloats(s []float64, i int, value float64) []float64 {
+	split := make([]float64, 0, len(s)+1)
+	split = append(split, s[:i]...)
+	split = append(split, value, value)
+	return append(split, s[i+1:]...)
+}
+
+// AccumulateTracked works like Accumulate but additionally tracks the
+// smallest and largest value accumulated into each bin, see BinMin and
+// BinMax. Only values accumulated with AccumulateTracked are tracked.
+func (bin *Bin) AccumulateTracked(value float64) int {
+	if bin.binMin == nil {
+		bin.binMin = make([]float64, len(bin.boundaries)+1)
+		bin.binMax = make([]float64, len(bin.boundaries)+1)
+		for n := range bin.binMin {
+			bin.binMin[n], bin.binMax[n] = math.NaN(), math.NaN()
+		}
+	}
+
+	n := bin.Accumulate(value)
+	if !(value >= bin.binMin[n]) {
+		bin.binMin[n] = value
+	}
+	if !(value <= bin.binMax[n]) {
+		bin.binMax[n] = value
+	}
+	return n
+}
+
+// BinMin returns the smallest value tracked in bin i, or NaN if no value
+// was tracked there
+func (bin *Bin) BinMin(i int) float64 {
+	if bin.binMin == nil {
+		return math.NaN()
+	}
+	return bin.binMin[i]
+}
+
+// BinMax returns the largest value tracked in bin i, or NaN if no value was
+// tracked there
+func (bin *Bin) BinMax(i int) float64 {
+	if bin.binMax == nil {
+		return math.NaN()
+	}
+	return bin.binMax[i]
+}
+
+// OccupancyStats summarizes how evenly the accumulated values spread over
+// the proper bins: the number of empty proper bins and the smallest,
+// largest and mean count of a proper bin. The mean is rounded down.
+// Underflow and overflow are not included. An empty Bin has no proper
+// bins and returns zeros.
+func (bin *Bin) OccupancyStats() (empty int, min, max, mean int64) {
+	counts := bin.Counts()
+	if len(counts) < 3 {
+		return 0, 0, 0, 0
+	}
+	proper := counts[1 : len(counts)-1]
+
+	min, max = proper[0], proper[0]
+	var total int64
+	for _, c := range proper {
+		if c == 0 {
+			empty++
+		}
+		if c < min {
+			min = c
+		}
+		if c > max {
+			max = c
+		}
+		total += c
+	}
+	return empty, min, max, total / int64(len(proper))
+}
+
+// PrometheusBuckets returns the accumulated counts as cumulative buckets in
+// the form Prometheus histograms use: each boundary maps to the number of
+// values less than or equal to it, and +Inf maps to the total count.
+// Prometheus buckets are "le", that is they include their upper bound,
+// while bins exclude it, so Accumulate remembers how many values lay
+// exactly on each boundary. Values on boundaries added by Insert or Rebin
+// are not known and count towards the next bucket.
+//
+// PrometheusBuckets only reads the Bin, so a collector may call it
+// concurrently; it must still not run concurrently with accumulation.
+func (bin *Bin) PrometheusBuckets() map[float64]uint64 {
+	counts, hits := bin.counts, bin.boundaryHits
+	if counts == nil {
+		counts = make([]int64, len(bin.boundaries)+1)
+		hits = make([]int64, len(bin.boundaries))
+	}
+
+	buckets := make(map[float64]uint64, len(bin.boundaries)+1)
+	var total int64
+	for n, b := range bin.boundaries {
+		total += counts[n]
+		buckets[b] = uint64(total + hits[n])
+	}
+	buckets[math.Inf(1)] = uint64(total + counts[len(bin.boundaries)])
+	return buckets
+}
+
+// BinCount is the accumulated count of a bin, see TopBins
+type BinCount struct {
+	Bin   int
+	Count int64
+}
+
+// TopBins returns the k bins with the highest accumulated counts, most
+// populated first. Bins with equal counts are ordered by bin number. The
+// underflow and overflow take part like any other bin. Fewer than k bins
+// are returned if the Bin has fewer.
+func (bin *Bin) TopBins(k int) []BinCount {
+	counts := bin.Counts()
+	top := make([]BinCount, len(counts))
+	for n, c := range counts {
+		top[n] = BinCount{Bin: n, Count: c}
+	}
+	// The stable sort keeps equal counts in bin number order
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+	if k < 0 {
+		k = 0
+	}
+	if k < len(top) {
+		top = top[:k]
+	}
+	return top
+}
+
+// WriteCSV writes the accumulated counts to w as CSV with the header
+// lo,hi,count and one row per bin number. The underflow and overflow rows
+// have the edges -Inf and +Inf respectively. If values were accumulated
+// with AccumulateWeighted, a weight column holds the weighted sums.
+func (bin *Bin) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"lo", "hi", "count"}
+	if bin.weights != nil {
+		header = append(header, "weight")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	counts := bin.Counts()
+	for n, count := range counts {
+		lo, hi := math.Inf(-1), math.Inf(1)
+		if n > 0 {
+			lo = bin.boundaries[n-1]
+		}
+		if n < len(bin.boundaries) {
+			hi = bin.boundaries[n]
+		}
+		row := []string{formatFloat(lo), formatFloat(hi), strconv.FormatInt(count, 10)}
+		if bin.weights != nil {
+			row = append(row, formatFloat(bin.weights[n]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Rebin creates a new Bin with the options of bin on newBoundaries and
+// redistributes the accumulated counts onto it. The count of each old
+// proper bin is split across the new bins it overlaps proportionally to the
+// length of the overlap, assuming values are uniformly distributed within
+// the bin. Parts outside the new boundaries go to the new underflow and
+// overflow, while the old underflow and overflow stay where they are.
+// Counts are rounded such that the total is preserved; weights are split
+// exactly. Tracked extremes, labels and which values lay exactly on a
+// boundary, see PrometheusBuckets, are not carried over. The single
+// bucket of an empty Bin is its underflow and stays in the new underflow.
+func (bin *Bin) Rebin(newBoundaries []float64) (*Bin, error) {
+	rebinned, err := newBin(append([]float64(nil), newBoundaries...), bin.opts)
+	if err != nil {
+		return nil, err
+	}
+	if bin.counts == nil {
+		return rebinned, nil
+	}
+
+	nb := rebinned.boundaries
+	counts := make([]int64, len(nb)+1)
+	counts[0] = bin.counts[0]
+	if !bin.empty {
+		counts[len(nb)] = bin.counts[len(bin.boundaries)]
+	}
+
+	var weights []float64
+	if bin.weights != nil {
+		weights = make([]float64, len(nb)+1)
+		weights[0] = bin.weights[0]
+		if !bin.empty {
+			weights[len(nb)] = bin.weights[len(bin.boundaries)]
+		}
+	}
+
+	for i := 1; i < len(bin.boundaries); i++ {
+		c := bin.counts[i]
+		lo, hi := bin.boundaries[i-1], bin.boundaries[i]
+
+		// share returns the part of bin i lying left of x
+		share := func(x float64) float64 {
+			return math.Max(0, math.Min(1, (x-lo)/(hi-lo)))
+		}
+
+		// Walk the new bins overlapping [lo, hi), starting with the one
+		// lo lies in. Rounding the running share rather than each part
+		// preserves the total count.
+		n := rebinned.search(lo)
+		assigned, prev := int64(0), 0.0
+		for ; n < len(nb) && nb[n] < hi; n++ {
+			frac := share(nb[n])
+			s := int64(math.Round(float64(c) * frac))
+			counts[n] += s - assigned
+			assigned = s
+			if weights != nil {
+				weights[n] += bin.weights[i] * (frac - prev)
+				prev = frac
+			}
+		}
+		counts[n] += c - assigned
+		if weights != nil {
+			weights[n] += bin.weights[i] * (1 - prev)
+		}
+	}
+
+	rebinned.counts = counts
+	rebinned.boundaryHits = make([]int64, len(nb))
+	rebinned.weights = weights
+	return rebinned, nil
+}
+
+// AccumulateWeighted works like Accumulate but additionally adds weight to
+// the weighted sum of the bin, see Weights and WeightedQuantile. Weights
+// should not be negative. Values accumulated with Accumulate carry no
+// weight.
+func (bin *Bin) AccumulateWeighted(value, weight float64) int {
+	if bin.weights == nil {
+		bin.weights = make([]float64, len(bin.boundaries)+1)
+	}
+
+	n := bin.Accumulate(value)
+	bin.weights[n] += weight
+	return n
+}
+
+// Weights returns a copy of the weighted sums accumulated with
+// AccumulateWeighted, indexed by bin number
+func (bin *Bin) Weights() []float64 {
+	if bin.weights == nil {
+		return make([]float64, len(bin.boundaries)+1)
+	}
+	return append([]float64(nil), bin.weights...)
+}
+
+// Quantile estimates the q-quantile of the accumulated values from the
+// counts, interpolating linearly within the bin the quantile falls into.
+// Quantiles falling into the underflow or overflow are reported as the
+// first or last boundary, the closest known bound. It returns NaN if
+// nothing was accumulated, q is not within [0, 1] or the Bin is empty.
+func (bin *Bin) Quantile(q float64) float64 {
+	mass := make([]float64, len(bin.boundaries)+1)
+	for n, c := range bin.Counts() {
+		mass[n] = float64(c)
+	}
+	return bin.interpolatedQuantile(q, mass)
+}
+
+// WeightedQuantile works like Quantile but uses the weighted sums of
+// AccumulateWeighted instead of the counts
+func (bin *Bin) WeightedQuantile(q float64) float64 {
+	return bin.interpolatedQuantile(q, bin.Weights())
+}
+
+// interpolatedQuantile returns the q-quantile of a distribution with the
+// given mass per bin number, assuming the mass is spread uniformly within
+// each bin
+func (bin *Bin) interpolatedQuantile(q float64, mass []float64) float64 {
+	if !(q >= 0 && q <= 1) || bin.empty {
+		return math.NaN()
+	}
+	var total float64
+	for _, m := range mass {
+		total += m
+	}
+	if !(total > 0) {
+		return math.NaN()
+	}
+
+	target := q * total
+	var cum float64
+	for n, m := range mass {
+		if m > 0 && cum+m >= target {
+			switch bin.Kind(n) {
+			case Underflow:
+				return bin.boundaries[0]
+			case Overflow:
+				return bin.boundaries[len(bin.boundaries)-1]
+			}
+			lo, hi := bin.boundaries[n-1], bin.boundaries[n]
+			return lo + (hi-lo)*math.Min(1, (target-cum)/m)
+		}
+		cum += m
+	}
+	// Rounding in the running sum can leave target just above it
+	return bin.boundaries[len(bin.boundaries)-1]
+}
+
+// Accumulator aggregates values per bin in any way, for AccumulateInto.
+// Add is called with the bin number of each value.
+type Accumulator interface {
+	Add(binNumber int, value float64)
+}
+
+// AccumulatorFunc adapts a function to an Accumulator
+type AccumulatorFunc func(binNumber int, value float64)
+
+// Add calls f(binNumber, value)
+func (f AccumulatorFunc) Add(binNumber int, value float64) {
+	f(binNumber, value)
+}
+
+// AccumulateInto searches the bin of value, passes both to acc and returns
+// the bin number. Unlike Accumulate it does not modify the Bin, so it may
+// run concurrently if acc allows it.
+func (bin *Bin) AccumulateInto(value float64, acc Accumulator) int {
+	n := bin.Search(value)
+	acc.Add(n, value)
+	return n
+}
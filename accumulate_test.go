@@ -0,0 +1,427 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func cmpInt64Slice(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i, x := range a {
+		if x != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAccumulate(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	if bin.UnderflowCount() != 0 || bin.OverflowCount() != 0 {
+		t.Errorf("Expected no underflow or overflow before accumulating")
+	}
+	for _, v := range []float64{-5, 1, 2, 3, 12, 25, 26, 99} {
+		bin.Accumulate(v)
+	}
+
+	expected := []int64{1, 3, 1, 2, 1}
+	if counts := bin.Counts(); !cmpInt64Slice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+	if bin.UnderflowCount() != 1 || bin.OverflowCount() != 1 {
+		t.Errorf("Expected an underflow and overflow of 1 but got %d and %d", bin.UnderflowCount(), bin.OverflowCount())
+	}
+
+	for n, exp := range []int64{1, 4, 5, 7, 8} {
+		if out := bin.CumulativeCount(n); out != exp {
+			t.Errorf("Expected cumulative count %d through bin %d but got %d", exp, n, out)
+		}
+	}
+
+	// Running totals follow new values
+	bin.Accumulate(15)
+	if out := bin.CumulativeCount(2); out != 6 {
+		t.Errorf("Expected cumulative count 6 through bin 2 but got %d", out)
+	}
+
+	// Concurrent readers must not race computing the totals, see go test -race
+	bin.Accumulate(15)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out := bin.CumulativeCount(2); out != 7 {
+				t.Errorf("Expected cumulative count 7 through bin 2 but got %d", out)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInsertSplitsCounts(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	for _, v := range []float64{-1, 1, 2, 3, 4, 15, 25} {
+		bin.Accumulate(v)
+	}
+
+	bin.Insert(2.5)
+	bin.Insert(-10)
+	bin.Insert(30)
+
+	// Bin [0, 10) held 4 values; a quarter of its width is below 2.5. The
+	// new edge bins are empty since underflow and overflow have no width.
+	expected := []int64{1, 0, 1, 3, 1, 0, 1}
+	if counts := bin.Counts(); !cmpInt64Slice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+}
+
+func TestRemoveMergesCounts(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	for _, v := range []float64{-1, 1, 2, 15, 25, 26, 99} {
+		bin.AccumulateTracked(v)
+	}
+
+	if err := bin.Remove(1); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []int64{1, 3, 2, 1}
+	if counts := bin.Counts(); !cmpInt64Slice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+	if bin.BinMin(1) != 1 || bin.BinMax(1) != 15 {
+		t.Errorf("Expected merged extremes 1 and 15 but got %f and %f", bin.BinMin(1), bin.BinMax(1))
+	}
+	if out := bin.Search(15); out != 1 {
+		t.Errorf("Expected 15 to be binned to 1 after removing 10 but got %d", out)
+	}
+
+	// Removing the last boundary merges the last proper bin into the overflow
+	if err := bin.Remove(2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = []int64{1, 3, 3}
+	if counts := bin.Counts(); !cmpInt64Slice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+
+	if err := bin.Remove(0); err == nil {
+		t.Errorf("Expected an error when leaving fewer than 2 boundaries")
+	}
+	for _, index := range []int{-1, 2} {
+		if err := bin.Remove(index); err == nil {
+			t.Errorf("Expected an error for index %d", index)
+		}
+	}
+}
+
+func TestAccumulateBeyond32Bits(t *testing.T) {
+	bin, _ := New([]float64{0, 10})
+	bin.Accumulate(5)
+
+	// Accumulating 2^32 values one by one takes too long for a test
+	bin.counts[1] = math.MaxUint32
+	bin.Accumulate(5)
+	bin.Accumulate(5)
+
+	if out := bin.Counts()[1]; out != math.MaxUint32+2 {
+		t.Errorf("Expected count %d but got %d", int64(math.MaxUint32+2), out)
+	}
+	if out := bin.CumulativeCount(2); out != math.MaxUint32+2 {
+		t.Errorf("Expected cumulative count %d but got %d", int64(math.MaxUint32+2), out)
+	}
+}
+
+func TestAccumulateTracked(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	for _, v := range []float64{5, 2, 8, 19, -3, -1} {
+		bin.AccumulateTracked(v)
+	}
+
+	expectedMin := []float64{-3, 2, 19}
+	expectedMax := []float64{-1, 8, 19}
+	for n := range expectedMin {
+		if bin.BinMin(n) != expectedMin[n] || bin.BinMax(n) != expectedMax[n] {
+			t.Errorf("Expected bin %d to range over [%f, %f] but got [%f, %f]", n, expectedMin[n], expectedMax[n], bin.BinMin(n), bin.BinMax(n))
+		}
+	}
+	if !math.IsNaN(bin.BinMin(3)) || !math.IsNaN(bin.BinMax(3)) {
+		t.Errorf("Expected NaN for the empty overflow but got [%f, %f]", bin.BinMin(3), bin.BinMax(3))
+	}
+	if !cmpInt64Slice(bin.Counts(), []int64{2, 3, 1, 0}) {
+		t.Errorf("Expected tracked values to be counted but got %v", bin.Counts())
+	}
+
+	bin.Insert(5)
+	if !math.IsNaN(bin.BinMin(1)) || !math.IsNaN(bin.BinMin(2)) || bin.BinMin(3) != 19 {
+		t.Errorf("Expected Insert to forget the extremes of the split bin only")
+	}
+}
+
+func TestOccupancyStats(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30, 40})
+	for _, v := range []float64{-5, 1, 2, 3, 4, 25, 26, 99, 99} {
+		bin.Accumulate(v)
+	}
+
+	empty, min, max, mean := bin.OccupancyStats()
+	if empty != 2 || min != 0 || max != 4 || mean != 1 {
+		t.Errorf("Expected (2, 0, 4, 1) but got (%d, %d, %d, %d)", empty, min, max, mean)
+	}
+
+	bin, _ = New([]float64{0, 10})
+	if empty, min, max, mean := bin.OccupancyStats(); empty != 1 || min != 0 || max != 0 || mean != 0 {
+		t.Errorf("Expected (1, 0, 0, 0) without accumulation but got (%d, %d, %d, %d)", empty, min, max, mean)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteCSV(t *testing.T) {
+	bin, _ := New([]float64{0, 0.5, 2})
+	for _, v := range []float64{-1, 0.1, 0.2, 1, 5, 5} {
+		bin.Accumulate(v)
+	}
+
+	var sb strings.Builder
+	if err := bin.WriteCSV(&sb); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	exp := "lo,hi,count\n-Inf,0,1\n0,0.5,2\n0.5,2,1\n2,+Inf,2\n"
+	if sb.String() != exp {
+		t.Errorf("Expected\n%s\nbut got\n%s", exp, sb.String())
+	}
+
+	if err := bin.WriteCSV(failingWriter{}); err == nil {
+		t.Errorf("Expected the write error to be returned")
+	}
+}
+
+func TestRebin(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	bin.Accumulate(-1)
+	for i := 0; i < 10; i++ {
+		bin.Accumulate(float64(i))
+		bin.Accumulate(10 + float64(i))
+	}
+	bin.Accumulate(99)
+	bin.Accumulate(99)
+
+	rebinned, err := bin.Rebin([]float64{5, 10, 12.5, 15, 30})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Half of [0, 10) lies below the new range and goes to the underflow
+	exp := []int64{1 + 5, 5, 3, 2, 5, 2}
+	if out := rebinned.Counts(); !cmpInt64Slice(out, exp) {
+		t.Errorf("Expected counts %v but got %v", exp, out)
+	}
+	if bin.CumulativeCount(3) != rebinned.CumulativeCount(5) {
+		t.Errorf("Expected the total to be preserved")
+	}
+
+	// Rounding the running share keeps each old bin's total
+	thirds, _ := bin.Rebin([]float64{0, 10.0 / 3, 20.0 / 3, 10, 20})
+	exp = []int64{1, 3, 4, 3, 10, 2}
+	if out := thirds.Counts(); !cmpInt64Slice(out, exp) {
+		t.Errorf("Expected counts %v but got %v", exp, out)
+	}
+
+	empty, _ := New([]float64{0, 1})
+	if rebinned, _ := empty.Rebin([]float64{0, 2}); !cmpInt64Slice(rebinned.Counts(), []int64{0, 0, 0}) {
+		t.Errorf("Expected no counts but got %v", rebinned.Counts())
+	}
+
+	if _, err := bin.Rebin([]float64{1, 1}); err == nil {
+		t.Errorf("Expected an error for invalid boundaries")
+	}
+}
+
+func TestWeightedQuantile(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	if !math.IsNaN(bin.Quantile(0.5)) || !math.IsNaN(bin.WeightedQuantile(0.5)) {
+		t.Errorf("Expected NaN quantiles before accumulating")
+	}
+
+	bin.AccumulateWeighted(5, 1)
+	bin.AccumulateWeighted(15, 3)
+
+	testData := []struct {
+		q, quantile, weighted float64
+	}{
+		{0, 0, 0},
+		{0.25, 5, 10},
+		{0.5, 10, 10 + 10.0/3},
+		{1, 20, 20},
+	}
+	for _, d := range testData {
+		if out := bin.Quantile(d.q); math.Abs(out-d.quantile) > 1e-12 {
+			t.Errorf("Expected the %f-quantile %f but got %f", d.q, d.quantile, out)
+		}
+		if out := bin.WeightedQuantile(d.q); math.Abs(out-d.weighted) > 1e-12 {
+			t.Errorf("Expected the weighted %f-quantile %f but got %f", d.q, d.weighted, out)
+		}
+	}
+	if !math.IsNaN(bin.Quantile(1.5)) {
+		t.Errorf("Expected NaN for q outside [0, 1]")
+	}
+
+	// Inserting a boundary splits the weight like the count
+	bin.Insert(12.5)
+	if w := bin.Weights(); !cmpFloatSlice(w, []float64{0, 1, 0.75, 2.25, 0}) {
+		t.Errorf("Expected weights [0 1 0.75 2.25 0] but got %v", w)
+	}
+
+	// Quantiles in the underflow are bounded by the first boundary
+	bin.AccumulateWeighted(-5, 100)
+	if out := bin.WeightedQuantile(0.5); out != 0 {
+		t.Errorf("Expected a weighted median of 0 but got %f", out)
+	}
+
+	rebinned, _ := bin.Rebin([]float64{0, 7.5, 20})
+	if w := rebinned.Weights(); !cmpFloatSlice(w, []float64{100, 0.75, 3.25, 0}) {
+		t.Errorf("Expected rebinned weights [100 0.75 3.25 0] but got %v", w)
+	}
+}
+
+func TestTopBins(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	for _, v := range []float64{-1, 1, 2, 15, 16, 25, 99, 99} {
+		bin.Accumulate(v)
+	}
+
+	exp := []BinCount{{1, 2}, {2, 2}, {4, 2}}
+	top := bin.TopBins(3)
+	if len(top) != len(exp) {
+		t.Fatalf("Expected %v but got %v", exp, top)
+	}
+	for i := range exp {
+		if top[i] != exp[i] {
+			t.Errorf("Expected %v but got %v", exp, top)
+			break
+		}
+	}
+
+	if all := bin.TopBins(100); len(all) != 5 || all[4] != (BinCount{3, 1}) {
+		t.Errorf("Expected all 5 bins ending with bin 3 but got %v", all)
+	}
+	if none := bin.TopBins(-1); len(none) != 0 {
+		t.Errorf("Expected no bins for negative k but got %v", none)
+	}
+}
+
+func TestPrometheusBuckets(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	for _, v := range []float64{-1, 1, 10, 15, 20, 99} {
+		bin.Accumulate(v)
+	}
+
+	// 10 and 20 lie on boundaries and count towards their own bucket
+	exp := map[float64]uint64{0: 1, 10: 3, 20: 5, math.Inf(1): 6}
+	buckets := bin.PrometheusBuckets()
+	if len(buckets) != len(exp) {
+		t.Fatalf("Expected buckets %v but got %v", exp, buckets)
+	}
+	for le, count := range exp {
+		if buckets[le] != count {
+			t.Errorf("Expected %d values in bucket %f but got %d", count, le, buckets[le])
+		}
+	}
+
+	empty, _ := New([]float64{0, 1})
+	if buckets := empty.PrometheusBuckets(); buckets[math.Inf(1)] != 0 || len(buckets) != 3 {
+		t.Errorf("Expected three empty buckets but got %v", buckets)
+	}
+
+	// Values on boundaries stay in their bucket when boundaries change
+	edges, _ := New([]float64{0, 10, 20})
+	for _, v := range []float64{0, 10, 10, 20} {
+		edges.Accumulate(v)
+	}
+	edges.Insert(5)
+	edges.Insert(30)
+	edges.Remove(3) // 20
+	exp = map[float64]uint64{0: 1, 5: 1, 10: 3, 30: 4, math.Inf(1): 4}
+	buckets = edges.PrometheusBuckets()
+	for le, count := range exp {
+		if buckets[le] != count {
+			t.Errorf("Expected %d values in bucket %f after changing boundaries but got %d", count, le, buckets[le])
+		}
+	}
+
+	// Concurrent scrapes must not race, see go test -race
+	bin.Accumulate(5)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if buckets := bin.PrometheusBuckets(); buckets[math.Inf(1)] != 7 {
+				t.Errorf("Expected 7 values in total but got %d", buckets[math.Inf(1)])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// maxAccumulator keeps the largest value per bin
+type maxAccumulator []float64
+
+func (m maxAccumulator) Add(binNumber int, value float64) {
+	if value > m[binNumber] {
+		m[binNumber] = value
+	}
+}
+
+func TestAccumulateInto(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	values := []float64{-1, 2, 3, 4, 12, 15, 25}
+
+	products := []float64{1, 1, 1, 1}
+	product := AccumulatorFunc(func(n int, v float64) { products[n] *= v })
+	maxima := maxAccumulator{math.Inf(-1), math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+
+	for _, v := range values {
+		if n := bin.AccumulateInto(v, product); n != bin.Search(v) {
+			t.Errorf("Expected AccumulateInto to return bin %d for %f but got %d", bin.Search(v), v, n)
+		}
+		bin.AccumulateInto(v, maxima)
+	}
+
+	if exp := []float64{-1, 24, 180, 25}; !cmpFloatSlice(products, exp) {
+		t.Errorf("Expected products %v but got %v", exp, products)
+	}
+	if exp := []float64{-1, 4, 15, 25}; !cmpFloatSlice(maxima, exp) {
+		t.Errorf("Expected maxima %v but got %v", exp, maxima)
+	}
+	if counts := bin.Counts(); !cmpInt64Slice(counts, []int64{0, 0, 0, 0}) {
+		t.Errorf("Expected AccumulateInto to leave the counts alone but got %v", counts)
+	}
+}
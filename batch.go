@@ -0,0 +1,184 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// SearchBatch returns the bin number of every value
+func (bin *Bin) SearchBatch(values []float64) []int {
+	bins := make([]int, len(values))
+	bin.SearchBatchInto(values, bins)
+	return bins
+}
+
+// SearchBatchInto writes the bin number of every value into out, which must
+// be at least as long as values. It does not allocate, so callers that
+// reuse out avoid any garbage per call.
+func (bin *Bin) SearchBatchInto(values []float64, out []int) {
+	out = out[:len(values)]
+	for i, v := range values {
+		out[i] = bin.Search(v)
+	}
+}
+
+// SearchBatchFloat32Into works like SearchBatchInto but writes the bin
+// numbers as float32, for uploading to a GPU without a separate conversion
+// pass. float32 represents integers exactly only up to 2^24, so bin numbers
+// of Bins with more than 2^24 boundaries may be rounded.
+func (bin *Bin) SearchBatchFloat32Into(values []float64, out []float32) {
+	out = out[:len(values)]
+	for i, v := range values {
+		out[i] = float32(bin.Search(v))
+	}
+}
+
+// Quantize maps every value to the Center of its bin
+func (bin *Bin) Quantize(values []float64) []float64 {
+	centers := make([]float64, len(values))
+	bin.QuantizeInto(values, centers)
+	return centers
+}
+
+// QuantizeInto works like Quantize but writes the centers into out, which
+// must be at least as long as values. Like SearchBatchInto, it does not
+// allocate.
+func (bin *Bin) QuantizeInto(values []float64, out []float64) {
+	out = out[:len(values)]
+	for i, v := range values {
+		out[i] = bin.Center(bin.Search(v))
+	}
+}
+
+// SearchBatchFilter returns the bin numbers of the values for which keep
+// returns true, together with the indices of these values in values. Other
+// values are skipped, so bins[i] is the bin number of values[indices[i]].
+func (bin *Bin) SearchBatchFilter(values []float64, keep func(float64) bool) (bins []int, indices []int) {
+	for i, v := range values {
+		if keep(v) {
+			bins = append(bins, bin.Search(v))
+			indices = append(indices, i)
+		}
+	}
+	return bins, indices
+}
+
+// SearchBatchParallel works like SearchBatch but splits values into one
+// chunk per worker and searches the chunks concurrently. Searching does not
+// modify the Bin, so no locking is needed. At most len(values) workers are
+// used, and at least one.
+func (bin *Bin) SearchBatchParallel(values []float64, workers int) []int {
+	if workers > len(values) {
+		workers = len(values)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	bins := make([]int, len(values))
+	chunk := (len(values) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(values); lo += chunk {
+		hi := lo + chunk
+		if hi > len(values) {
+			hi = len(values)
+		}
+
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i, v := range values[lo:hi] {
+				bins[lo+i] = bin.Search(v)
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+
+	return bins
+}
+
+// contextCheckInterval is the number of values SearchBatchContext searches
+// between checking whether its context is done
+const contextCheckInterval = 1 << 14
+
+// SearchBatchContext works like SearchBatch but stops early if ctx is done,
+// returning the error of ctx. ctx is checked every contextCheckInterval
+// values.
+func (bin *Bin) SearchBatchContext(ctx context.Context, values []float64) ([]int, error) {
+	bins := make([]int, len(values))
+	for i, v := range values {
+		if i%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		bins[i] = bin.Search(v)
+	}
+	return bins, nil
+}
+
+// SearchSorted returns the bin number of every value like SearchBatch, but
+// exploits ascending input: it keeps a cursor into the boundaries that only
+// moves forward, so a sorted batch costs O(len(values) + len(boundaries))
+// comparisons in total. Values that are out of order are still binned
+// correctly; each one restarts the cursor with a full Search, which is
+// O(1) on average like any other Search.
+func (bin *Bin) SearchSorted(values []float64) []int {
+	bins := make([]int, len(values))
+	b := bin.boundaries
+	cursor := 0 // number of boundaries at or below the previous value
+	prev := math.Inf(-1)
+	for i, v := range values {
+		if !bin.covers(v) {
+			bins[i] = bin.Search(v)
+			continue
+		}
+		if v < prev {
+			// Restart the cursor at the bin of v, which is the number of
+			// boundaries at or below v
+			cursor = bin.search(v)
+		}
+		for cursor < len(b) && v >= b[cursor] {
+			cursor++
+		}
+		prev = v
+		bins[i] = cursor
+		if bin.opts != (Options{}) {
+			bins[i] = bin.applyOptions(cursor, v)
+		}
+	}
+	return bins
+}
+
+// SearchChan sends the bin number of every value received on in to out and
+// closes out once in is closed. Like StreamingCounter.Feed it blocks, so it
+// is usually run in its own goroutine:
+//
+//	go bin.SearchChan(values, bins)
+//
+// Sending blocks until out is read, so a slow consumer slows down reading
+// from in. The Bin must be created with New or another constructor before.
+func (bin *Bin) SearchChan(in <-chan float64, out chan<- int) {
+	defer close(out)
+	for v := range in {
+		out <- bin.Search(v)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func benchmarkData(n int) (*Bin, []float64) {
+	return benchmarkDataWithBoundaries(1000, n)
+}
+
+func benchmarkDataWithBoundaries(boundaryCount, n int) (*Bin, []float64) {
+	rng := rand.New(rand.NewSource(1))
+	boundaries := randomBoundaries(rng, boundaryCount)
+	bin, _ := New(boundaries)
+
+	lo, hi := boundaries[0], boundaries[len(boundaries)-1]
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = lo + rng.Float64()*(hi-lo)
+	}
+	return bin, values
+}
+
+func TestSearchBatch(t *testing.T) {
+	bin, values := benchmarkData(10000)
+
+	serial := bin.SearchBatch(values)
+	for _, workers := range []int{-1, 0, 1, 3, 8, 20000} {
+		parallel := bin.SearchBatchParallel(values, workers)
+		if !cmpIntSlice(serial, parallel) {
+			t.Errorf("Expected parallel search with %d workers to match the serial search", workers)
+		}
+	}
+	for i, v := range values {
+		if serial[i] != bin.Search(v) {
+			t.Fatalf("Expected %f to be binned to %d but got %d", v, bin.Search(v), serial[i])
+		}
+	}
+
+	if out := bin.SearchBatchParallel(nil, 4); len(out) != 0 {
+		t.Errorf("Expected empty result for empty input but got %v", out)
+	}
+}
+
+func TestSearchBatchFilter(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	values := []float64{-5, 5, 25, -1, 30}
+
+	bins, indices := bin.SearchBatchFilter(values, func(v float64) bool { return v >= 0 })
+	if !cmpIntSlice(bins, []int{1, 3, 4}) {
+		t.Errorf("Expected bins [1 3 4] but got %v", bins)
+	}
+	if !cmpIntSlice(indices, []int{1, 2, 4}) {
+		t.Errorf("Expected indices [1 2 4] but got %v", indices)
+	}
+
+	bins, indices = bin.SearchBatchFilter(values, func(float64) bool { return false })
+	if len(bins) != 0 || len(indices) != 0 {
+		t.Errorf("Expected nothing to be kept but got %v and %v", bins, indices)
+	}
+}
+
+func BenchmarkSearchBatch(b *testing.B) {
+	bin, values := benchmarkData(1 << 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bin.SearchBatch(values)
+	}
+}
+
+func BenchmarkSearchBatchParallel(b *testing.B) {
+	bin, values := benchmarkData(1 << 20)
+	workers := runtime.GOMAXPROCS(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bin.SearchBatchParallel(values, workers)
+	}
+}
+
+func TestSearchBatchContext(t *testing.T) {
+	bin, values := benchmarkData(3 * contextCheckInterval)
+
+	bins, err := bin.SearchBatchContext(context.Background(), values)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmpIntSlice(bins, bin.SearchBatch(values)) {
+		t.Errorf("Expected SearchBatchContext to match SearchBatch")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bin.SearchBatchContext(ctx, values); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
+
+func TestSearchBatchIntoDoesNotAllocate(t *testing.T) {
+	bin, values := benchmarkData(1000)
+	out := make([]int, len(values))
+
+	if allocs := testing.AllocsPerRun(100, func() { bin.SearchBatchInto(values, out) }); allocs != 0 {
+		t.Errorf("Expected SearchBatchInto not to allocate but got %f allocations per run", allocs)
+	}
+	if !cmpIntSlice(out, bin.SearchBatch(values)) {
+		t.Errorf("Expected SearchBatchInto to match SearchBatch")
+	}
+}
+
+func BenchmarkSearchBatchInto(b *testing.B) {
+	bin, values := benchmarkData(1 << 20)
+	out := make([]int, len(values))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bin.SearchBatchInto(values, out)
+	}
+}
+
+func TestSearchSorted(t *testing.T) {
+	bin, values := benchmarkData(10000)
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	if got, want := bin.SearchSorted(sorted), bin.SearchBatch(sorted); !cmpIntSlice(got, want) {
+		t.Errorf("Expected SearchSorted to match SearchBatch on sorted input")
+	}
+
+	// Unsorted input is still binned correctly, just without the speedup
+	if got, want := bin.SearchSorted(values), bin.SearchBatch(values); !cmpIntSlice(got, want) {
+		t.Errorf("Expected SearchSorted to match SearchBatch on unsorted input")
+	}
+
+	edges := []float64{-1, 2, 2, 30, 31, 3, math.Inf(1), 6, 29.9}
+	bin, _ = New([]float64{2, 6, 10, 11, 30})
+	if got, want := bin.SearchSorted(edges), bin.SearchBatch(edges); !cmpIntSlice(got, want) {
+		t.Errorf("Expected %v but got %v", want, got)
+	}
+}
+
+func BenchmarkSearchSorted(b *testing.B) {
+	bin, values := benchmarkData(b.N)
+	sort.Float64s(values)
+	b.ResetTimer()
+	bin.SearchSorted(values)
+}
+
+func TestSearchBatchFloat32Into(t *testing.T) {
+	bin, values := benchmarkData(1000)
+	out := make([]float32, len(values))
+	if allocs := testing.AllocsPerRun(10, func() { bin.SearchBatchFloat32Into(values, out) }); allocs != 0 {
+		t.Errorf("Expected SearchBatchFloat32Into not to allocate but got %f allocations", allocs)
+	}
+	for i, n := range bin.SearchBatch(values) {
+		if out[i] != float32(n) {
+			t.Fatalf("Expected %f to be binned to %d but got %f", values[i], n, out[i])
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	bin, _ := New([]float64{0, 1, 4, 10})
+	values := []float64{-3, 0, 0.9, 2, 4, 9.9, 10, 42}
+
+	exp := []float64{0, 0.5, 0.5, 2.5, 7, 7, 10, 10}
+	if out := bin.Quantize(values); !cmpFloatSlice(out, exp) {
+		t.Errorf("Expected %v but got %v", exp, out)
+	}
+
+	out := make([]float64, len(values))
+	allocs := testing.AllocsPerRun(100, func() { bin.QuantizeInto(values, out) })
+	if allocs != 0 {
+		t.Errorf("Expected QuantizeInto not to allocate but got %f allocations", allocs)
+	}
+	if !cmpFloatSlice(out, exp) {
+		t.Errorf("Expected %v but got %v", exp, out)
+	}
+}
+
+func BenchmarkQuantizeInto(b *testing.B) {
+	bin, values := benchmarkData(1 << 16)
+	out := make([]float64, len(values))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bin.QuantizeInto(values, out)
+	}
+}
+
+func TestSearchChan(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	in := make(chan float64)
+	out := make(chan int)
+	go bin.SearchChan(in, out)
+
+	values := []float64{-1, 5, 15, 25, 10}
+	go func() {
+		for _, v := range values {
+			in <- v
+		}
+		close(in)
+	}()
+
+	var bins []int
+	for n := range out {
+		bins = append(bins, n)
+	}
+	if !cmpIntSlice(bins, []int{0, 1, 2, 3, 2}) {
+		t.Errorf("Expected bins [0 1 2 3 2] but got %v", bins)
+	}
+}
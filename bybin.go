@@ -0,0 +1,262 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Methods in this file bin keys and compute a statistic of associated data
+// per bin. Results are indexed by bin number as returned by Search and thus
+// have len(boundaries)+1 entries, including underflow and overflow.
+
+func checkSameLength(keysName string, keys []float64, dataName string, data []float64) error {
+	if len(keys) != len(data) {
+		return fmt.Errorf("%s and %s must have the same length but have %d and %d", keysName, dataName, len(keys), len(data))
+	}
+	return nil
+}
+
+// EffectiveSampleSize returns Kish's effective sample size (Σw)² / Σw² of the
+// weights whose keys fall into each bin. Empty bins have an effective sample
+// size of 0.
+func (bin *Bin) EffectiveSampleSize(keys, weights []float64) ([]float64, error) {
+	if err := checkSameLength("keys", keys, "weights", weights); err != nil {
+		return nil, err
+	}
+
+	sum := make([]float64, len(bin.boundaries)+1)
+	sumSquares := make([]float64, len(bin.boundaries)+1)
+	for i, key := range keys {
+		n := bin.Search(key)
+		sum[n] += weights[i]
+		sumSquares[n] += weights[i] * weights[i]
+	}
+
+	ess := make([]float64, len(sum))
+	for n := range ess {
+		if sumSquares[n] > 0 {
+			ess[n] = sum[n] * sum[n] / sumSquares[n]
+		}
+	}
+	return ess, nil
+}
+
+// GroupByBin returns the values grouped by their bin number. Within each
+// group values keep their original order.
+func (bin *Bin) GroupByBin(values []float64) [][]float64 {
+	groups := make([][]float64, len(bin.boundaries)+1)
+	for _, v := range values {
+		n := bin.Search(v)
+		groups[n] = append(groups[n], v)
+	}
+	return groups
+}
+
+// kdeCutoff is the distance in bandwidths beyond which KDEAt ignores data.
+// A Gaussian kernel is below 3.4e-4 of its peak there.
+const kdeCutoff = 4
+
+// KDEAt estimates the density at x using a Gaussian kernel density estimate
+// with the given bandwidth over grouped, which are values grouped by
+// GroupByBin of this Bin. Only the bins within kdeCutoff bandwidths of x are
+// visited, so the cost depends on the data close to x rather than on all
+// data. Returns NaN for a non-positive bandwidth.
+func (bin *Bin) KDEAt(grouped [][]float64, x, bandwidth float64) float64 {
+	if !(bandwidth > 0) {
+		return math.NaN()
+	}
+
+	total := 0
+	for _, group := range grouped {
+		total += len(group)
+	}
+	if total == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	first, last := bin.Search(x-kdeCutoff*bandwidth), bin.Search(x+kdeCutoff*bandwidth)
+	for _, group := range grouped[first : last+1] {
+		for _, v := range group {
+			u := (x - v) / bandwidth
+			sum += math.Exp(-u * u / 2)
+		}
+	}
+	return sum / (float64(total) * bandwidth * math.Sqrt(2*math.Pi))
+}
+
+// ObserveEMA searches the bin of value and updates the exponential moving
+// average of that bin in emas with observation:
+//
+//	emas[bin] = alpha*observation + (1-alpha)*emas[bin]
+//
+// emas must be indexed by bin number. Returns the bin number.
+func (bin *Bin) ObserveEMA(value, observation float64, emas []float64, alpha float64) int {
+	n := bin.Search(value)
+	emas[n] = alpha*observation + (1-alpha)*emas[n]
+	return n
+}
+
+// quantile returns the q-quantile of sorted, interpolating linearly between
+// the closest ranks. Returns NaN for an empty slice.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// QuantileByBin groups targets by the bin of their key and returns the
+// q-quantile of the targets in each bin, interpolating linearly between
+// the closest ranks. Bins without targets are NaN.
+func (bin *Bin) QuantileByBin(keys, targets []float64, q float64) ([]float64, error) {
+	if err := checkSameLength("keys", keys, "targets", targets); err != nil {
+		return nil, err
+	}
+	if !(q >= 0 && q <= 1) {
+		return nil, fmt.Errorf("q must be within [0, 1] but is %f", q)
+	}
+
+	groups := make([][]float64, len(bin.boundaries)+1)
+	for i, key := range keys {
+		n := bin.Search(key)
+		groups[n] = append(groups[n], targets[i])
+	}
+
+	quantiles := make([]float64, len(groups))
+	for n, group := range groups {
+		sort.Float64s(group)
+		quantiles[n] = quantile(group, q)
+	}
+	return quantiles, nil
+}
+
+// WindowedCounts bins timestamps with this Bin and values with valueBin, and
+// returns one histogram of values per sliding window of windowBins proper
+// time bins. Window w covers the time bins w+1 to w+windowBins, so there are
+// len(boundaries)-windowBins windows, each with counts indexed by the bin
+// numbers of valueBin. Values with a timestamp outside of the proper time
+// bins are ignored.
+func (bin *Bin) WindowedCounts(valueBin *Bin, timestamps, values []float64, windowBins int) ([][]int, error) {
+	if err := checkSameLength("timestamps", timestamps, "values", values); err != nil {
+		return nil, err
+	}
+	timeBins := len(bin.boundaries) - 1
+	if windowBins < 1 || windowBins > timeBins {
+		return nil, fmt.Errorf("windowBins must be within [1, %d] but is %d", timeBins, windowBins)
+	}
+
+	// Histogram per time bin, then sum them up over sliding windows
+	perTimeBin := make([][]int, timeBins+2)
+	for n := range perTimeBin {
+		perTimeBin[n] = make([]int, len(valueBin.boundaries)+1)
+	}
+	for i, ts := range timestamps {
+		perTimeBin[bin.Search(ts)][valueBin.Search(values[i])]++
+	}
+
+	windows := make([][]int, timeBins-windowBins+1)
+	window := make([]int, len(valueBin.boundaries)+1)
+	for n := 1; n <= timeBins; n++ {
+		for i, c := range perTimeBin[n] {
+			window[i] += c
+		}
+		if n > windowBins {
+			for i, c := range perTimeBin[n-windowBins] {
+				window[i] -= c
+			}
+		}
+		if n >= windowBins {
+			windows[n-windowBins] = append([]int(nil), window...)
+		}
+	}
+	return windows, nil
+}
+
+// FirstLastByBin returns, per bin, the index of the first and of the last
+// value in values that falls into that bin. Both are -1 for empty bins.
+func (bin *Bin) FirstLastByBin(values []float64) (first, last []int) {
+	first = make([]int, len(bin.boundaries)+1)
+	last = make([]int, len(bin.boundaries)+1)
+	for n := range first {
+		first[n], last[n] = -1, -1
+	}
+
+	for i, v := range values {
+		n := bin.Search(v)
+		if first[n] < 0 {
+			first[n] = i
+		}
+		last[n] = i
+	}
+	return first, last
+}
+
+// WeightedSEMByBin returns, per bin of keys, the standard error of the
+// weighted mean of the targets in that bin. With the weighted mean m, the
+// weighted variance v = Σw(x-m)² / Σw and Kish's effective sample size n,
+// the standard error is sqrt(v / (n-1)), which for equal weights is the
+// usual standard error of the mean. Bins with an effective sample size of at
+// most one are NaN.
+func (bin *Bin) WeightedSEMByBin(keys, targets, weights []float64) ([]float64, error) {
+	if err := checkSameLength("keys", keys, "targets", targets); err != nil {
+		return nil, err
+	}
+	if err := checkSameLength("keys", keys, "weights", weights); err != nil {
+		return nil, err
+	}
+
+	bins := make([]int, len(keys))
+	sum := make([]float64, len(bin.boundaries)+1)
+	sumSquares := make([]float64, len(bin.boundaries)+1)
+	weightedSum := make([]float64, len(bin.boundaries)+1)
+	for i, key := range keys {
+		n := bin.Search(key)
+		bins[i] = n
+		sum[n] += weights[i]
+		sumSquares[n] += weights[i] * weights[i]
+		weightedSum[n] += weights[i] * targets[i]
+	}
+
+	// Second pass for the variance around the weighted means
+	variance := make([]float64, len(sum))
+	for i, n := range bins {
+		d := targets[i] - weightedSum[n]/sum[n]
+		variance[n] += weights[i] * d * d
+	}
+
+	sem := make([]float64, len(sum))
+	for n := range sem {
+		sem[n] = math.NaN()
+		if sumSquares[n] == 0 {
+			continue
+		}
+		if ess := sum[n] * sum[n] / sumSquares[n]; ess > 1 {
+			sem[n] = math.Sqrt(variance[n] / sum[n] / (ess - 1))
+		}
+	}
+	return sem, nil
+}
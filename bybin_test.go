@@ -0,0 +1,190 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEffectiveSampleSize(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+
+	keys := []float64{1, 2, 3, 4, 11, 12, 25}
+	weights := []float64{1, 1, 1, 1, 3, 1, 2}
+
+	ess, err := bin.EffectiveSampleSize(keys, weights)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Equal weights give the plain count; one dominating weight reduces it
+	expected := []float64{0, 4, 1.6, 1}
+	if !cmpFloatSlice(ess, expected) {
+		t.Errorf("Expected effective sample sizes\n%v but got\n%v\n", expected, ess)
+	}
+
+	if _, err := bin.EffectiveSampleSize(keys, weights[1:]); err == nil {
+		t.Errorf("Expected error on length mismatch")
+	}
+}
+
+func TestKDEAt(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30, 40})
+	values := []float64{-100, 1, 12, 14, 15, 17, 33, 100}
+	grouped := bin.GroupByBin(values)
+
+	if len(grouped[2]) != 4 || grouped[2][0] != 12 || grouped[2][3] != 17 {
+		t.Errorf("Expected bin 2 to hold [12 14 15 17] but got %v", grouped[2])
+	}
+
+	// Compare against the full sum over all values
+	for _, x := range []float64{-100, 0, 13, 15, 25, 39, 50} {
+		exp := 0.0
+		for _, v := range values {
+			u := (x - v) / 2
+			exp += math.Exp(-u*u/2) / (float64(len(values)) * 2 * math.Sqrt(2*math.Pi))
+		}
+		if out := bin.KDEAt(grouped, x, 2); math.Abs(out-exp) > 1e-4*exp+1e-12 {
+			t.Errorf("Expected density %g at %f but got %g", exp, x, out)
+		}
+	}
+
+	if out := bin.KDEAt(grouped, 15, 0); !math.IsNaN(out) {
+		t.Errorf("Expected NaN for zero bandwidth but got %g", out)
+	}
+}
+
+func TestObserveEMA(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	emas := make([]float64, 4)
+
+	if n := bin.ObserveEMA(5, 100, emas, 0.5); n != 1 {
+		t.Errorf("Expected 5 to be binned to 1 but got %d", n)
+	}
+	bin.ObserveEMA(7, 20, emas, 0.5)
+	bin.ObserveEMA(25, 8, emas, 0.25)
+
+	expected := []float64{0, 35, 0, 2}
+	if !cmpFloatSlice(emas, expected) {
+		t.Errorf("Expected emas\n%v but got\n%v\n", expected, emas)
+	}
+}
+
+func TestQuantileByBin(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+
+	keys := []float64{1, 2, 3, 4, 5, 15, 25}
+	targets := []float64{50, 10, 40, 20, 30, 7, 9}
+
+	medians, err := bin.QuantileByBin(keys, targets, 0.5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !math.IsNaN(medians[0]) || medians[1] != 30 || medians[2] != 7 || medians[3] != 9 {
+		t.Errorf("Expected medians [NaN 30 7 9] but got %v", medians)
+	}
+
+	p90, _ := bin.QuantileByBin(keys, targets, 0.9)
+	if p90[1] != 46 {
+		t.Errorf("Expected P90 46 in bin 1 but got %f", p90[1])
+	}
+
+	if _, err := bin.QuantileByBin(keys, targets, 1.5); err == nil {
+		t.Errorf("Expected error for q outside [0, 1]")
+	}
+	if _, err := bin.QuantileByBin(keys, targets[1:], 0.5); err == nil {
+		t.Errorf("Expected error on length mismatch")
+	}
+}
+
+func TestWindowedCounts(t *testing.T) {
+	timeBin, _ := New([]float64{0, 1, 2, 3})
+	valueBin, _ := New([]float64{0, 10})
+
+	timestamps := []float64{0.5, 0.5, 1.5, 2.5, 2.5, 2.5, 5}
+	values := []float64{5, -1, 5, 15, 5, 5, 5}
+
+	windows, err := timeBin.WindowedCounts(valueBin, timestamps, values, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := [][]int{{1, 2, 0}, {0, 3, 1}}
+	if len(windows) != len(expected) {
+		t.Fatalf("Expected windows\n%v but got\n%v\n", expected, windows)
+	}
+	for i := range expected {
+		if !cmpIntSlice(windows[i], expected[i]) {
+			t.Errorf("Expected windows\n%v but got\n%v\n", expected, windows)
+		}
+	}
+
+	if _, err := timeBin.WindowedCounts(valueBin, timestamps, values, 4); err == nil {
+		t.Errorf("Expected error for a window larger than the time bins")
+	}
+}
+
+func TestFirstLastByBin(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+
+	first, last := bin.FirstLastByBin([]float64{5, 15, 6, -1, 7, 25})
+	if !cmpIntSlice(first, []int{3, 0, 1, 5}) {
+		t.Errorf("Expected first indices [3 0 1 5] but got %v", first)
+	}
+	if !cmpIntSlice(last, []int{3, 4, 1, 5}) {
+		t.Errorf("Expected last indices [3 4 1 5] but got %v", last)
+	}
+
+	first, last = bin.FirstLastByBin([]float64{5})
+	if !cmpIntSlice(first, []int{-1, 0, -1, -1}) || !cmpIntSlice(last, []int{-1, 0, -1, -1}) {
+		t.Errorf("Expected -1 for empty bins but got %v and %v", first, last)
+	}
+}
+
+func TestWeightedSEMByBin(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+
+	keys := []float64{1, 2, 3, 4, 11, 12, 15}
+	targets := []float64{2, 4, 4, 6, 1, 5, 9}
+	weights := []float64{1, 1, 1, 1, 1, 2, 1}
+
+	sem, err := bin.WeightedSEMByBin(keys, targets, weights)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Equal weights give the plain standard error: sample variance 8/3 of 4
+	if exp := math.Sqrt(8.0 / 3 / 4); math.Abs(sem[1]-exp) > 1e-12 {
+		t.Errorf("Expected standard error %f in bin 1 but got %f", exp, sem[1])
+	}
+	// Weighted mean 5, variance 32/4 = 8, effective sample size 16/6
+	if exp := math.Sqrt(8 / (16.0/6 - 1)); math.Abs(sem[2]-exp) > 1e-12 {
+		t.Errorf("Expected standard error %f in bin 2 but got %f", exp, sem[2])
+	}
+	if !math.IsNaN(sem[0]) || !math.IsNaN(sem[3]) {
+		t.Errorf("Expected NaN for empty bins but got %v", sem)
+	}
+
+	single, _ := bin.WeightedSEMByBin([]float64{5}, []float64{1}, []float64{3})
+	if !math.IsNaN(single[1]) {
+		t.Errorf("Expected NaN for a single observation but got %f", single[1])
+	}
+
+	if _, err := bin.WeightedSEMByBin(keys, targets, weights[1:]); err == nil {
+		t.Errorf("Expected error on length mismatch")
+	}
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// NewFast works like New but additionally builds a table mapping each
+// uniform bin directly to its first boundary and its number of boundaries.
+// Search then reads both from a single table entry instead of from the
+// histogram and the cumulative histogram, saving a memory access per
+// search at the cost of another table of two ints per bin. Whether that
+// pays off depends on the size of the Bin and the CPU caches; compare with
+// the BenchmarkSearch benchmarks.
+func NewFast(boundaries []float64) (*Bin, error) {
+	boundaries = append([]float64(nil), boundaries...)
+	if err := validateBoundaries(boundaries); err != nil {
+		return nil, err
+	}
+
+	bin := &Bin{
+		boundaries: boundaries,
+		fast:       true,
+	}
+	if err := bin.precalculation(bin.defaultUniformBinWidth()); err != nil {
+		return nil, err
+	}
+	return bin, nil
+}
+
+// maxUniformBins limits the number of uniform bins of a Bin
+const maxUniformBins = math.MaxInt32
+
+// NewWithBinWidth works like New but uses uniform bins of the given width
+// instead of dividing the range into as many uniform bins as there are
+// bins. Narrower uniform bins hold fewer boundaries each, making Search
+// faster on skewed boundaries at the cost of larger histograms; wider ones
+// save space. The width is kept when inserting boundaries.
+func NewWithBinWidth(boundaries []float64, uniformWidth float64) (*Bin, error) {
+	boundaries = append([]float64(nil), boundaries...)
+	if err := validateBoundaries(boundaries); err != nil {
+		return nil, err
+	}
+
+	bin := &Bin{
+		boundaries:           boundaries,
+		fixedUniformBinWidth: uniformWidth,
+	}
+	if err := bin.precalculation(uniformWidth); err != nil {
+		return nil, err
+	}
+	return bin, nil
+}
+
+// NewSafe works like New but accepts empty boundaries, for which it returns
+// an empty Bin instead of an error. Search on an empty Bin returns 0, the
+// underflow, for every value, so code can search and accumulate before
+// boundaries are known. Covers reports false for any value, and Center,
+// NearestBoundary and Quantile return NaN. Boundary must not be used on it,
+// and Insert errors; create a new Bin once boundaries are available.
+func NewSafe(boundaries []float64) (*Bin, error) {
+	if len(boundaries) == 0 {
+		return &Bin{empty: true}, nil
+	}
+	return New(boundaries)
+}
+
+// NewSorted creates a Bin from boundaries in any order. The boundaries are
+// sorted in a copy, so the given slice is left untouched. Duplicate
+// boundaries still return an error.
+func NewSorted(boundaries []float64) (*Bin, error) {
+	sorted := append([]float64(nil), boundaries...)
+	sort.Float64s(sorted)
+	return newBin(sorted, Options{})
+}
+
+// NewFromWidths creates a Bin whose first boundary is start and whose bins
+// have the given widths from left to right. Widths must be positive and
+// finite, and large enough relative to the boundaries to change them.
+func NewFromWidths(start float64, widths []float64) (*Bin, error) {
+	if err := checkFinite(start); err != nil {
+		return nil, err
+	}
+
+	boundaries := make([]float64, len(widths)+1)
+	boundaries[0] = start
+	for i, w := range widths {
+		if !(w > 0) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("widths must be positive and finite. Found %f at index %d", w, i)
+		}
+		boundaries[i+1] = boundaries[i] + w
+		if boundaries[i+1] == boundaries[i] {
+			return nil, fmt.Errorf("width %g at index %d is lost in rounding at boundary %g", w, i, boundaries[i])
+		}
+	}
+	return newBin(boundaries, Options{})
+}
+
+// uniformBoundaries returns n+1 boundaries dividing [min, max] into n bins
+// of equal width. The extreme boundaries are exactly min and max.
+func uniformBoundaries(min, max float64, n int) []float64 {
+	boundaries := make([]float64, n+1)
+	for i := range boundaries {
+		boundaries[i] = min + (max-min)*float64(i)/float64(n)
+	}
+	boundaries[n] = max
+	return boundaries
+}
+
+// NewWithinBudget creates a Bin of uniform bins over [min, max] using as
+// many bins as fit into maxBytes. The budget covers the boundaries and the
+// two histograms of the precalculation, but not the slice headers or the
+// Bin itself, as reported by MemoryBytes.
+func NewWithinBudget(min, max float64, maxBytes int) (*Bin, error) {
+	// m bins need m+1 boundaries, a histogram of m and a cumulative
+	// histogram of m+1 ints
+	intSize := strconv.IntSize / 8
+	m := (maxBytes - 8 - intSize) / (8 + 2*intSize)
+	if m < 1 {
+		return nil, fmt.Errorf("a budget of %d bytes does not fit a single bin", maxBytes)
+	}
+
+	return newBin(uniformBoundaries(min, max, m), Options{})
+}
+
+// dataRange returns the smallest and largest value in data. It errors if
+// data is empty, contains non-finite values or has no spread.
+func dataRange(data []float64) (float64, float64, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("data must not be empty")
+	}
+
+	min, max := data[0], data[0]
+	for i, x := range data {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return 0, 0, fmt.Errorf("data must be finite. Found %f at index %d", x, i)
+		}
+		if x < min {
+			min = x
+		}
+		if x > max {
+			max = x
+		}
+	}
+	if min == max {
+		return 0, 0, fmt.Errorf("data must contain at least two distinct values")
+	}
+	return min, max, nil
+}
+
+// NewMDL creates a Bin of uniform bins over the range of data, choosing the
+// number of bins between 1 and maxBins that minimizes the description
+// length of data. The largest value lies in the last proper bin.
+//
+// The description length of k bins holding n_1, ..., n_k of the N values is
+// the stochastic complexity by Rissanen, Speed and Yu:
+//
+//	log C(N+k-1, k-1) + log(N! / (n_1! ... n_k!)) - N log k
+//
+// The first term encodes the counts, the second which value is in which bin
+// and the last is the gain in resolution from narrower bins. More bins
+// only pay off if the data is far from uniform across them.
+func NewMDL(data []float64, maxBins int) (*Bin, error) {
+	if maxBins < 1 {
+		return nil, fmt.Errorf("maxBins must be at least 1 but is %d", maxBins)
+	}
+	min, max, err := dataRange(data)
+	if err != nil {
+		return nil, err
+	}
+	// Bins are right-open; extend the range so that max is inside
+	max = math.Nextafter(max, math.Inf(1))
+
+	var best *Bin
+	bestLength := math.Inf(1)
+	counts := make([]int, maxBins+2)
+	for k := 1; k <= maxBins; k++ {
+		var bin *Bin
+		bin, err = newBin(uniformBoundaries(min, max, k), Options{})
+		if err != nil {
+			// The range cannot be divided any finer
+			break
+		}
+
+		for i := range counts {
+			counts[i] = 0
+		}
+		for _, x := range data {
+			counts[bin.Search(x)]++
+		}
+
+		N := float64(len(data))
+		lgammaNk, _ := math.Lgamma(N + float64(k))
+		lgammaK, _ := math.Lgamma(float64(k))
+		length := lgammaNk - lgammaK - N*math.Log(float64(k))
+		for _, n := range counts[1 : k+1] {
+			lgammaN, _ := math.Lgamma(float64(n) + 1)
+			length -= lgammaN
+		}
+
+		if length < bestLength {
+			best, bestLength = bin, length
+		}
+	}
+	if best == nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// niceSteps are the mantissas, times ten, of the step sizes NewNice chooses
+// from
+var niceSteps = []int64{10, 20, 25, 50, 100}
+
+// NewNice creates uniform bins over at least [min, max] whose boundaries are
+// round numbers, as used for chart axes. The step is the one of 1, 2, 2.5, 5
+// or 10 times a power of ten closest to (max-min)/approxBins, and the range
+// is extended outwards to multiples of the step. Like the other
+// constructors building bins for data, max lies in the last proper bin: a
+// max that is a multiple of the step gets one more step above it.
+func NewNice(min, max float64, approxBins int) (*Bin, error) {
+	if approxBins < 1 {
+		return nil, fmt.Errorf("approxBins must be at least 1 but is %d", approxBins)
+	}
+	if !(min < max) || math.IsInf(min, 0) || math.IsInf(max, 0) {
+		return nil, fmt.Errorf("need a finite range with min < max but got [%f, %f]", min, max)
+	}
+
+	raw := (max - min) / float64(approxBins)
+	exponent := int(math.Floor(math.Log10(raw))) - 1
+	scale := math.Pow(10, float64(exponent))
+
+	// Pick the step closest to raw on a logarithmic scale
+	step := niceSteps[0]
+	for _, s := range niceSteps[1:] {
+		if math.Abs(math.Log(float64(s)*scale/raw)) < math.Abs(math.Log(float64(step)*scale/raw)) {
+			step = s
+		}
+	}
+
+	// Boundaries are k*step*scale. Dividing by an exact power of ten rather
+	// than multiplying with its inexact inverse keeps them round.
+	toValue := func(k int64) float64 {
+		if exponent < 0 {
+			return float64(k*step) / math.Pow(10, float64(-exponent))
+		}
+		return float64(k*step) * scale
+	}
+	first := int64(math.Floor(min / (float64(step) * scale)))
+	last := int64(math.Ceil(max / (float64(step) * scale)))
+	for toValue(first) > min {
+		first--
+	}
+	// Bins are right-open; go past a max on a multiple of the step
+	for toValue(last) <= max {
+		last++
+	}
+
+	boundaries := make([]float64, 0, last-first+1)
+	for k := first; k <= last; k++ {
+		boundaries = append(boundaries, toValue(k))
+	}
+	return newBin(boundaries, Options{})
+}
+
+// NewTrimmed creates bins uniform bins over the range between the
+// trimFraction and the 1-trimFraction quantile of data, so that a few
+// outliers do not stretch the bins. Values beyond that range fall into the
+// underflow and overflow. The upper quantile itself lies in the last proper
+// bin. trimFraction must be within [0, 0.5).
+func NewTrimmed(data []float64, trimFraction float64, bins int) (*Bin, error) {
+	if !(trimFraction >= 0 && trimFraction < 0.5) {
+		return nil, fmt.Errorf("trimFraction must be within [0, 0.5) but is %f", trimFraction)
+	}
+	if bins < 1 {
+		return nil, fmt.Errorf("bins must be at least 1 but is %d", bins)
+	}
+	if _, _, err := dataRange(data); err != nil {
+		return nil, err
+	}
+
+	sorted := append([]float64(nil), data...)
+	sort.Float64s(sorted)
+	min, max := quantile(sorted, trimFraction), quantile(sorted, 1-trimFraction)
+	if min == max {
+		return nil, fmt.Errorf("the trimmed range [%f, %f] is empty", min, max)
+	}
+
+	return newBin(uniformBoundaries(min, math.Nextafter(max, math.Inf(1)), bins), Options{})
+}
+
+// Builder collects boundaries one at a time and creates a Bin from them
+// without copying. Ordering errors are reported by Add as they happen.
+type Builder struct {
+	boundaries []float64
+}
+
+// NewBuilder creates a Builder with room for capacity boundaries. Adding
+// more boundaries still works but reallocates.
+func NewBuilder(capacity int) *Builder {
+	return &Builder{boundaries: make([]float64, 0, capacity)}
+}
+
+// Add appends boundary, which must be finite and larger than all boundaries
+// added before
+func (b *Builder) Add(boundary float64) error {
+	if err := checkFinite(boundary); err != nil {
+		return fmt.Errorf("%w at index %d", err, len(b.boundaries))
+	}
+	if n := len(b.boundaries); n > 0 && b.boundaries[n-1] >= boundary {
+		return fmt.Errorf("boundaries must be monotonically sorted. Found %f >= %f at index %d and %d", b.boundaries[n-1], boundary, n-1, n)
+	}
+	b.boundaries = append(b.boundaries, boundary)
+	return nil
+}
+
+// Build creates a Bin from the added boundaries. The Bin takes over the
+// boundaries, so the Builder is empty afterwards.
+func (b *Builder) Build() (*Bin, error) {
+	boundaries := b.boundaries
+	b.boundaries = nil
+	return newBin(boundaries, Options{})
+}
+
+// NewFromReader creates a Bin from the boundaries read from r, separated by
+// any ASCII whitespace including newlines. The boundaries are parsed and
+// checked for order while reading, so errors name the offending line.
+func NewFromReader(r io.Reader) (*Bin, error) {
+	line, tokenLine := 1, 1
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		for ; start < len(data) && isASCIISpace(data[start]); start++ {
+			if data[start] == '\n' {
+				line++
+			}
+		}
+		for i := start; i < len(data); i++ {
+			if isASCIISpace(data[i]) {
+				tokenLine = line
+				return i, data[start:i], nil
+			}
+		}
+		if atEOF && start < len(data) {
+			tokenLine = line
+			return len(data), data[start:], nil
+		}
+		// Request more data; the skipped whitespace is consumed and counted
+		return start, nil, nil
+	})
+
+	b := NewBuilder(0)
+	for scanner.Scan() {
+		boundary, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", tokenLine, err)
+		}
+		if err := b.Add(boundary); err != nil {
+			return nil, fmt.Errorf("line %d: %w", tokenLine, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b.Build()
+}
+
+func isASCIISpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
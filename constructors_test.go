@@ -0,0 +1,473 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewWithinBudget(t *testing.T) {
+	intSize := strconv.IntSize / 8
+	perBin := 8 + 2*intSize
+	fixed := 8 + intSize
+
+	bin, err := NewWithinBudget(0, 10, fixed+10*perBin+perBin-1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if !cmpFloatSlice(bin.boundaries, expected) {
+		t.Errorf("Expected boundaries\n%v but got\n%v\n", expected, bin.boundaries)
+	}
+	if out := bin.MemoryBytes(); out != fixed+10*perBin {
+		t.Errorf("Expected %d bytes but got %d", fixed+10*perBin, out)
+	}
+
+	if _, err := NewWithinBudget(0, 10, fixed+perBin-1); err == nil {
+		t.Errorf("Expected error when the budget does not fit a single bin")
+	}
+}
+
+func TestDefaultUniformBinCount(t *testing.T) {
+	// 2.1/(2.1/7) rounds to slightly above 7, which must not add a uniform bin
+	boundaries := uniformBoundaries(0, 2.1, 7)
+	if w := 2.1 / 7; math.Ceil(2.1/w) != 8 {
+		t.Fatalf("Expected the test range to round up to 8 uniform bins")
+	}
+
+	bin, err := New(boundaries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(bin.histogram) != 7 {
+		t.Errorf("Expected 7 uniform bins but got %d", len(bin.histogram))
+	}
+	if !bin.uniform {
+		t.Errorf("Expected uniform boundaries to be detected")
+	}
+	for v := -0.05; v < 2.2; v += 0.01 {
+		if out, exp := bin.Search(v), linearSearch(boundaries, v); out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d", v, exp, out)
+		}
+	}
+
+	intSize := strconv.IntSize / 8
+	budget := 8 + intSize + 7*(8+2*intSize)
+	if bin, err := NewWithinBudget(0, 2.1, budget); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	} else if out := bin.MemoryBytes(); out > budget {
+		t.Errorf("Expected at most %d bytes but got %d", budget, out)
+	}
+}
+
+func TestNewMDL(t *testing.T) {
+	// Two well separated clusters are best described by more than one bin,
+	// while uniform data is best described by a single bin.
+	var clustered, uniform []float64
+	for i := 0; i < 100; i++ {
+		clustered = append(clustered, float64(i%10)/100, 10+float64(i%10)/100)
+		uniform = append(uniform, float64(i))
+	}
+
+	bin, err := NewMDL(clustered, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := len(bin.boundaries) - 1; n < 2 {
+		t.Errorf("Expected clustered data to use several bins but got %d", n)
+	}
+	if out := bin.Search(10.09); out != len(bin.boundaries)-1 {
+		t.Errorf("Expected the largest value to be in the last proper bin but got %d", out)
+	}
+
+	bin, err = NewMDL(uniform, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := len(bin.boundaries) - 1; n != 1 {
+		t.Errorf("Expected uniform data to use a single bin but got %d", n)
+	}
+
+	if _, err := NewMDL([]float64{1, 1, 1}, 5); err == nil {
+		t.Errorf("Expected error for data without spread")
+	}
+	if _, err := NewMDL(uniform, 0); err == nil {
+		t.Errorf("Expected error for maxBins < 1")
+	}
+	if bin, err := NewMDL([]float64{-1.7e308, 1.7e308}, 5); err == nil || bin != nil {
+		t.Errorf("Expected error for data too wide for a single bin but got %v, %v", bin, err)
+	}
+}
+
+func TestNewSorted(t *testing.T) {
+	boundaries := []float64{20, 2, 30, 11}
+
+	bin, err := NewSorted(boundaries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []float64{2, 11, 20, 30}
+	if !cmpFloatSlice(bin.boundaries, expected) {
+		t.Errorf("Expected boundaries\n%v but got\n%v\n", expected, bin.boundaries)
+	}
+	if !cmpFloatSlice(boundaries, []float64{20, 2, 30, 11}) {
+		t.Errorf("NewSorted modified its input: %v", boundaries)
+	}
+	if out := bin.Search(15); out != 2 {
+		t.Errorf("Expected 15 to be binned to 2 but got %d", out)
+	}
+
+	if _, err := NewSorted([]float64{3, 1, 3}); err == nil {
+		t.Errorf("Expected error for duplicate boundaries")
+	}
+}
+
+func TestNewNice(t *testing.T) {
+	testData := []struct {
+		min, max   float64
+		approxBins int
+		expected   []float64
+	}{
+		{0.13, 0.97, 4, []float64{0, 0.2, 0.4, 0.6, 0.8, 1}},
+		{3, 97, 10, []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}},
+		{-12, 38, 2, []float64{-25, 0, 25, 50}},
+		{1200, 5100, 2, []float64{0, 2000, 4000, 6000}},
+		{0.3, 0.9, 3, []float64{0.2, 0.4, 0.6, 0.8, 1}},
+		{0, 1, 5, []float64{0, 0.2, 0.4, 0.6, 0.8, 1, 1.2}},
+	}
+
+	for _, d := range testData {
+		bin, err := NewNice(d.min, d.max, d.approxBins)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if !cmpFloatSlice(bin.boundaries, d.expected) {
+			t.Errorf("Expected [%f, %f] in %d bins to give\n%v but got\n%v\n", d.min, d.max, d.approxBins, d.expected, bin.boundaries)
+		}
+		if out := bin.Search(d.max); out != len(bin.boundaries)-1 {
+			t.Errorf("Expected max %f to be binned to the last proper bin but got %d", d.max, out)
+		}
+	}
+
+	if _, err := NewNice(1, 1, 5); err == nil {
+		t.Errorf("Expected error for an empty range")
+	}
+	if _, err := NewNice(0, 1, 0); err == nil {
+		t.Errorf("Expected error for approxBins < 1")
+	}
+}
+
+func TestNewFast(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		boundaries := randomBoundaries(rng, 2+rng.Intn(100))
+		bin, err := NewFast(boundaries)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(bin.uniformIndex) != len(bin.histogram) {
+			t.Fatalf("Expected a uniform index of %d entries but got %d", len(bin.histogram), len(bin.uniformIndex))
+		}
+
+		lo, hi := boundaries[0], boundaries[len(boundaries)-1]
+		for j := 0; j < 100; j++ {
+			v := lo + (rng.Float64()*1.2-0.1)*(hi-lo)
+			if out, exp := bin.Search(v), linearSearch(boundaries, v); out != exp {
+				t.Fatalf("Expected %g to be binned to %d but got %d", v, exp, out)
+			}
+		}
+	}
+}
+
+func TestNewWithBinWidth(t *testing.T) {
+	boundaries := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+
+	bin, err := NewWithBinWidth(boundaries, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(bin.histogram) != 28 {
+		t.Errorf("Expected 28 uniform bins but got %d", len(bin.histogram))
+	}
+	for _, h := range bin.histogram {
+		if h > 1 {
+			t.Errorf("Expected at most one boundary per uniform bin but got %v", bin.histogram)
+			break
+		}
+	}
+
+	// Widths that do not divide the range evenly get a partial last bin
+	for _, width := range []float64{1, 3, 4, 7.5, 100} {
+		bin, err := NewWithBinWidth(boundaries, width)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		bin.Insert(24)
+		for v := 0.0; v < 32; v += 0.25 {
+			if out, exp := bin.Search(v), linearSearch(bin.boundaries, v); out != exp {
+				t.Errorf("Expected %f to be binned to %d with width %f but got %d", v, exp, width, out)
+			}
+		}
+		if bin.uniformBinWidth != width {
+			t.Errorf("Expected Insert to keep the uniform bin width %f but got %f", width, bin.uniformBinWidth)
+		}
+	}
+
+	for _, width := range []float64{0, -1, math.Inf(1), math.NaN(), 1e-12} {
+		if _, err := NewWithBinWidth(boundaries, width); err == nil {
+			t.Errorf("Expected error for uniform bin width %f", width)
+		}
+	}
+}
+
+func TestNewTrimmed(t *testing.T) {
+	data := []float64{-1000}
+	for i := 0; i <= 100; i++ {
+		data = append(data, float64(i))
+	}
+	data = append(data, 1e9)
+
+	bin, err := NewTrimmed(data, 0.01, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if lo, hi := bin.Boundary(0), bin.Boundary(10); math.Abs(lo-0.02) > 1e-9 || math.Abs(hi-99.98) > 1e-9 {
+		t.Errorf("Expected the trimmed range to be [0.02, 99.98] but got [%f, %f]", lo, hi)
+	}
+	if out := bin.Search(-1000); out != 0 {
+		t.Errorf("Expected the low outlier in the underflow but got %d", out)
+	}
+	if out := bin.Search(1e9); out != 11 {
+		t.Errorf("Expected the high outlier in the overflow but got %d", out)
+	}
+
+	if _, err := NewTrimmed(data, 0.5, 10); err == nil {
+		t.Errorf("Expected error for trimFraction 0.5")
+	}
+	if _, err := NewTrimmed([]float64{1, 5, 5, 5, 9}, 0.25, 10); err == nil {
+		t.Errorf("Expected error for an empty trimmed range")
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(4)
+	for _, boundary := range []float64{2, 11, 19, 20} {
+		if err := b.Add(boundary); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	exp := "boundaries must be monotonically sorted. Found 20.000000 >= 20.000000 at index 3 and 4"
+	if err := b.Add(20); err == nil || err.Error() != exp {
+		t.Errorf("Expected error %q but got %v", exp, err)
+	}
+	if err := b.Add(math.NaN()); err == nil {
+		t.Errorf("Expected an error for NaN")
+	}
+
+	bin, err := b.Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmpFloatSlice(bin.Boundaries(), []float64{2, 11, 19, 20}) {
+		t.Errorf("Expected boundaries [2 11 19 20] but got %v", bin.Boundaries())
+	}
+	if out := bin.Search(19.5); out != 3 {
+		t.Errorf("Expected 19.5 to be binned to 3 but got %d", out)
+	}
+
+	// The Bin owns the boundaries now; later additions must not touch it
+	_ = b.Add(1)
+	if bin.Boundary(0) != 2 {
+		t.Errorf("Expected the Builder to start over after Build")
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	bin, err := NewFromReader(strings.NewReader("2 11\n19\t20\r\n\n  21 27 29\n30"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	exp := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+	if !cmpFloatSlice(bin.Boundaries(), exp) {
+		t.Errorf("Expected boundaries %v but got %v", exp, bin.Boundaries())
+	}
+
+	testData := map[string]string{
+		"1 2\n3\n\n3 4":  "line 4: boundaries must be monotonically sorted",
+		"1 2\n3 x":       "line 2: strconv.ParseFloat",
+		"1\n\n\n2 NaN\n": "line 4: boundaries must be finite",
+		"  7  ":          "need at least 2 boundaries",
+	}
+	for input, exp := range testData {
+		// Reading byte by byte splits tokens and newlines across reads
+		for _, r := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+			_, err := NewFromReader(r)
+			if err == nil || !strings.HasPrefix(err.Error(), exp) {
+				t.Errorf("Expected error starting with %q for %q but got %v", exp, input, err)
+			}
+		}
+	}
+}
+
+func TestNewSafe(t *testing.T) {
+	for _, boundaries := range [][]float64{nil, {}, {1}} {
+		if _, err := New(boundaries); err == nil {
+			t.Errorf("Expected New to return an error for %v", boundaries)
+		}
+	}
+
+	bin, err := NewSafe(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	values := []float64{math.Inf(-1), -1, 0, 1e300}
+	for _, v := range values {
+		if out := bin.Search(v); out != 0 {
+			t.Errorf("Expected %f to be binned to 0 in an empty Bin but got %d", v, out)
+		}
+		if out, err := bin.SearchE(v); out != 0 || err != nil {
+			t.Errorf("Expected SearchE to bin %f to 0 in an empty Bin but got %d, %v", v, out, err)
+		}
+		searches := map[string]int{
+			"SearchFloat32": bin.SearchFloat32(float32(v)),
+			"SearchApprox":  bin.SearchApprox(v),
+			"SearchHint":    bin.SearchHint(v, 1),
+			"LinearSearch":  bin.LinearSearch(v),
+			"SearchPacked":  int(bin.SearchPacked(v)),
+			"SearchR":       bin.SearchR(v).Number(),
+		}
+		for name, out := range searches {
+			if out != 0 {
+				t.Errorf("Expected %s to bin %f to 0 in an empty Bin but got %d", name, v, out)
+			}
+		}
+		if n, kind := bin.SearchClassified(v); n != 0 || kind != Underflow {
+			t.Errorf("Expected %f to be classified as underflow but got %d, %s", v, n, kind)
+		}
+		if n, frac := bin.SearchFraction(v); n != 0 || frac != 0 {
+			t.Errorf("Expected SearchFraction to return 0, 0 for %f but got %d, %f", v, n, frac)
+		}
+		if _, ok := bin.ProperBinIndex(v); ok {
+			t.Errorf("Expected %f not to lie in a proper bin", v)
+		}
+		if idx, b := bin.NearestBoundary(v); idx != -1 || !math.IsNaN(b) {
+			t.Errorf("Expected no nearest boundary in an empty Bin but got %d, %f", idx, b)
+		}
+	}
+
+	zeros := make([]int, len(values))
+	batches := map[string][]int{
+		"SearchBatch":         bin.SearchBatch(values),
+		"SearchSorted":        bin.SearchSorted(values),
+		"SearchBatchParallel": bin.SearchBatchParallel(values, 2),
+	}
+	for name, out := range batches {
+		if !cmpIntSlice(out, zeros) {
+			t.Errorf("Expected %s to bin everything to 0 in an empty Bin but got %v", name, out)
+		}
+	}
+	if bin.Covers(values) || bin.CoverageFraction(values) != 0 {
+		t.Errorf("Expected an empty Bin to cover no values")
+	}
+	for _, q := range bin.Quantize(values) {
+		if !math.IsNaN(q) {
+			t.Errorf("Expected an empty Bin to quantize to NaN but got %v", bin.Quantize(values))
+			break
+		}
+	}
+
+	bin.Accumulate(5)
+	bin.AccumulateWeighted(-1, 2)
+	if counts := bin.Counts(); !cmpInt64Slice(counts, []int64{2}) {
+		t.Errorf("Expected counts [2] but got %v", counts)
+	}
+	if bin.CumulativeCount(0) != 2 || bin.UnderflowCount() != 2 || bin.OverflowCount() != 0 {
+		t.Errorf("Expected the single bucket to count once as underflow but got cumulative %d, underflow %d and overflow %d",
+			bin.CumulativeCount(0), bin.UnderflowCount(), bin.OverflowCount())
+	}
+	if empty, min, max, mean := bin.OccupancyStats(); empty != 0 || min != 0 || max != 0 || mean != 0 {
+		t.Errorf("Expected no occupancy without proper bins but got %d, %d, %d, %d", empty, min, max, mean)
+	}
+	if buckets := bin.PrometheusBuckets(); len(buckets) != 1 || buckets[math.Inf(1)] != 2 {
+		t.Errorf("Expected a single +Inf bucket of 2 but got %v", buckets)
+	}
+	if top := bin.TopBins(3); len(top) != 1 || top[0] != (BinCount{0, 2}) {
+		t.Errorf("Expected the single bucket as top bin but got %v", top)
+	}
+	if !math.IsNaN(bin.Quantile(0.5)) || !math.IsNaN(bin.WeightedQuantile(0.5)) {
+		t.Errorf("Expected no quantiles in an empty Bin but got %f and %f", bin.Quantile(0.5), bin.WeightedQuantile(0.5))
+	}
+	if err := bin.WriteCSV(io.Discard); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if index, width, risky := bin.NarrowestBin(); index != -1 || !math.IsNaN(width) || risky {
+		t.Errorf("Expected no narrowest bin in an empty Bin but got %d, %f, %t", index, width, risky)
+	}
+	if mapping := bin.EqualizationMap([]int{2}); len(mapping) != 1 || !math.IsNaN(mapping[0]) {
+		t.Errorf("Expected an empty Bin to equalize to [NaN] but got %v", mapping)
+	}
+	rebinned, err := bin.Rebin([]float64{0, 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if counts := rebinned.Counts(); !cmpInt64Slice(counts, []int64{2, 0, 0}) {
+		t.Errorf("Expected Rebin to keep the single bucket as underflow but got %v", counts)
+	}
+	if weights := rebinned.Weights(); !cmpFloatSlice(weights, []float64{2, 0, 0}) {
+		t.Errorf("Expected Rebin to keep the single weight as underflow but got %v", weights)
+	}
+	if out := bin.String(); out != "Bin{empty}" {
+		t.Errorf("Expected an empty Bin to print as Bin{empty} but got %s", out)
+	}
+	if err := bin.Insert(1); err == nil {
+		t.Errorf("Expected an error when inserting into an empty Bin")
+	}
+
+	if bin, err := NewSafe([]float64{1, 2}); err != nil || bin.Search(1.5) != 1 {
+		t.Errorf("Expected NewSafe to work like New for valid boundaries")
+	}
+	if _, err := NewSafe([]float64{2, 1}); err == nil {
+		t.Errorf("Expected NewSafe to return an error for unsorted boundaries")
+	}
+}
+
+func TestNewFromWidths(t *testing.T) {
+	bin, err := NewFromWidths(2, []float64{9, 8, 1, 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if exp := []float64{2, 11, 19, 20, 21}; !cmpFloatSlice(bin.Boundaries(), exp) {
+		t.Errorf("Expected boundaries %v but got %v", exp, bin.Boundaries())
+	}
+
+	for _, widths := range [][]float64{nil, {1, 0}, {1, -1}, {math.Inf(1)}, {math.NaN()}, {1e-20}} {
+		if _, err := NewFromWidths(1, widths); err == nil {
+			t.Errorf("Expected an error for widths %v", widths)
+		}
+	}
+	if _, err := NewFromWidths(math.NaN(), []float64{1}); err == nil {
+		t.Errorf("Expected an error for a NaN start")
+	}
+}
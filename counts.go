@@ -0,0 +1,343 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"fmt"
+	"math"
+)
+
+// Methods in this file work on per-bin counts. Counts are indexed by bin
+// number as returned by Search: counts[0] is the underflow, counts[i] the
+// proper bin [Boundary(i-1), Boundary(i)) and counts[len(boundaries)] the
+// overflow. Such a slice thus has len(boundaries)+1 entries.
+
+func (bin *Bin) checkCounts(counts []int) error {
+	if len(counts) != len(bin.boundaries)+1 {
+		return fmt.Errorf("expected %d counts for %d boundaries but got %d", len(bin.boundaries)+1, len(bin.boundaries), len(counts))
+	}
+	return nil
+}
+
+// MergeToMinCount merges adjacent proper bins until every proper bin holds at
+// least minCount. The bin with the smallest count is merged first, into its
+// smaller neighbour. The underflow and overflow counts are carried over
+// unchanged since they cannot be merged without changing the covered range.
+//
+// Returns the reduced Bin together with the merged counts. An error is
+// returned if counts does not match the Bin or if the proper bins together
+// hold less than minCount.
+func (bin *Bin) MergeToMinCount(counts []int, minCount int) (*Bin, []int, error) {
+	if err := bin.checkCounts(counts); err != nil {
+		return nil, nil, err
+	}
+
+	boundaries := append([]float64(nil), bin.boundaries...)
+	merged := append([]int(nil), counts...)
+
+	for {
+		// Proper bins are 1..n-1
+		n := len(boundaries)
+		smallest := 0
+		for i := 1; i < n; i++ {
+			if merged[i] < minCount && (smallest == 0 || merged[i] < merged[smallest]) {
+				smallest = i
+			}
+		}
+		if smallest == 0 {
+			break
+		}
+		if n == 2 {
+			return nil, nil, fmt.Errorf("proper bins hold %d values in total which is less than minCount %d", merged[1], minCount)
+		}
+
+		// Merge bins lo and lo+1 by dropping the boundary between them
+		lo := smallest
+		if smallest == n-1 || (smallest > 1 && merged[smallest-1] <= merged[smallest+1]) {
+			lo = smallest - 1
+		}
+		merged[lo] += merged[lo+1]
+		merged = append(merged[:lo+1], merged[lo+2:]...)
+		boundaries = append(boundaries[:lo], boundaries[lo+1:]...)
+	}
+
+	reduced, err := newBin(boundaries, bin.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reduced, merged, nil
+}
+
+// SmoothCounts returns the moving average of counts over a centered window of
+// window bins. Near the edges the window shrinks to the bins that exist, so
+// every average is taken over actual counts only. For even windows the extra
+// bin is taken from the right. A window smaller than 1 is treated as 1.
+func SmoothCounts(counts []int, window int) []float64 {
+	if window < 1 {
+		window = 1
+	}
+	left, right := (window-1)/2, window/2
+
+	// Prefix sums let us average each window in constant time
+	prefix := make([]int, len(counts)+1)
+	for i, c := range counts {
+		prefix[i+1] = prefix[i] + c
+	}
+
+	smoothed := make([]float64, len(counts))
+	for i := range counts {
+		lo, hi := i-left, i+right+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(counts) {
+			hi = len(counts)
+		}
+		smoothed[i] = float64(prefix[hi]-prefix[lo]) / float64(hi-lo)
+	}
+	return smoothed
+}
+
+// SearchWithCount returns the bin number of value together with the count
+// of that bin in counts, which must be indexed by bin number.
+func (bin *Bin) SearchWithCount(value float64, counts []int) (index, count int) {
+	index = bin.Search(value)
+	return index, counts[index]
+}
+
+// Autocorrelation returns the normalized autocorrelation of counts for the
+// lags 0 to maxLag, where a lag is measured in bins. Lag 0 is always 1;
+// peaks at a lag k hint at periodic structure every k bins. maxLag is
+// limited to len(counts)-1. Constant counts have no defined
+// autocorrelation, in which case all entries are 0.
+func Autocorrelation(counts []int, maxLag int) []float64 {
+	if maxLag > len(counts)-1 {
+		maxLag = len(counts) - 1
+	}
+	if maxLag < 0 {
+		return nil
+	}
+
+	mean := 0.0
+	for _, c := range counts {
+		mean += float64(c)
+	}
+	mean /= float64(len(counts))
+
+	variance := 0.0
+	for _, c := range counts {
+		variance += (float64(c) - mean) * (float64(c) - mean)
+	}
+
+	acf := make([]float64, maxLag+1)
+	if variance == 0 {
+		return acf
+	}
+	for lag := range acf {
+		sum := 0.0
+		for i := 0; i+lag < len(counts); i++ {
+			sum += (float64(counts[i]) - mean) * (float64(counts[i+lag]) - mean)
+		}
+		acf[lag] = sum / variance
+	}
+	return acf
+}
+
+// CountRange counts the values within [lo, hi] per bin. Values outside of
+// [lo, hi] are skipped before searching for their bin, so bins only
+// partially overlapping [lo, hi] count just the values inside it. The
+// returned counts are indexed by bin number like the counts of all bins.
+func (bin *Bin) CountRange(values []float64, lo, hi float64) ([]int, error) {
+	if !(lo <= hi) {
+		return nil, fmt.Errorf("lo must not be larger than hi but got [%f, %f]", lo, hi)
+	}
+
+	counts := make([]int, len(bin.boundaries)+1)
+	for _, v := range values {
+		if !(v >= lo && v <= hi) {
+			// Also skips NaN, which lies in no range
+			continue
+		}
+		counts[bin.Search(v)]++
+	}
+	return counts, nil
+}
+
+// normalize returns counts divided by their total, together with the total
+func normalize(counts []int) ([]float64, int) {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	p := make([]float64, len(counts))
+	if total == 0 {
+		return p, 0
+	}
+	for i, c := range counts {
+		p[i] = float64(c) / float64(total)
+	}
+	return p, total
+}
+
+// jsDivergence returns the Jensen-Shannon divergence in bits between two
+// distributions of the same length
+func jsDivergence(p, q []float64) float64 {
+	d := 0.0
+	for i := range p {
+		m := (p[i] + q[i]) / 2
+		if p[i] > 0 {
+			d += p[i] * math.Log2(p[i]/m)
+		}
+		if q[i] > 0 {
+			d += q[i] * math.Log2(q[i]/m)
+		}
+	}
+	return d / 2
+}
+
+// DiffMatrix returns the pairwise Jensen-Shannon divergences between
+// histograms, suitable as a distance matrix for clustering or heatmaps.
+// Divergences are measured in bits, so they lie within [0, 1] where 0 means
+// identical distributions. An empty histogram has divergence 0 to another
+// empty one and 1 to any other.
+//
+// All histograms must have the same length; DiffMatrix panics otherwise.
+func DiffMatrix(histograms [][]int) [][]float64 {
+	distributions := make([][]float64, len(histograms))
+	empty := make([]bool, len(histograms))
+	for i, h := range histograms {
+		if len(h) != len(histograms[0]) {
+			panic(fmt.Sprintf("histograms must have the same length but histogram %d has %d bins instead of %d", i, len(h), len(histograms[0])))
+		}
+		var total int
+		distributions[i], total = normalize(h)
+		empty[i] = total == 0
+	}
+
+	matrix := make([][]float64, len(histograms))
+	for i := range matrix {
+		matrix[i] = make([]float64, len(histograms))
+	}
+	for i := range matrix {
+		for j := i + 1; j < len(matrix); j++ {
+			var d float64
+			switch {
+			case empty[i] && empty[j]:
+				d = 0
+			case empty[i] || empty[j]:
+				d = 1
+			default:
+				d = jsDivergence(distributions[i], distributions[j])
+			}
+			matrix[i][j], matrix[j][i] = d, d
+		}
+	}
+	return matrix
+}
+
+// KSStatistic returns the Kolmogorov-Smirnov statistic between the binned
+// data in counts and the reference distribution refCDF: the largest
+// absolute difference between the empirical and the reference CDF. Both
+// are evaluated at the boundaries only, since the empirical CDF of binned
+// data is not known in between.
+//
+// KSStatistic panics if counts does not have one entry per bin number and
+// returns NaN if counts are all zero.
+func (bin *Bin) KSStatistic(counts []int, refCDF func(float64) float64) float64 {
+	if err := bin.checkCounts(counts); err != nil {
+		panic(err.Error())
+	}
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+
+	// Values below boundary i are exactly those in bins 0..i
+	d, cumulative := 0.0, 0
+	for i, b := range bin.boundaries {
+		cumulative += counts[i]
+		d = math.Max(d, math.Abs(float64(cumulative)/float64(total)-refCDF(b)))
+	}
+	return d
+}
+
+// TotalVariation returns the total variation distance between the
+// distributions of the counts p and q, 0.5 * Σ |p_i/Σp - q_i/Σq|. It lies
+// within [0, 1] where 0 means identical distributions. Like DiffMatrix, an
+// empty histogram has distance 0 to another empty one and 1 to any other.
+func TotalVariation(p, q []int) (float64, error) {
+	if len(p) != len(q) {
+		return 0, fmt.Errorf("p and q must have the same length but have %d and %d", len(p), len(q))
+	}
+
+	pNorm, pTotal := normalize(p)
+	qNorm, qTotal := normalize(q)
+	if pTotal == 0 || qTotal == 0 {
+		if pTotal == qTotal {
+			return 0, nil
+		}
+		return 1, nil
+	}
+
+	d := 0.0
+	for i := range pNorm {
+		d += math.Abs(pNorm[i] - qNorm[i])
+	}
+	return d / 2, nil
+}
+
+// EqualizationMap returns the histogram equalization transform for counts:
+// per bin, the value that members of the bin map to so that the result is
+// spread evenly over [Boundary(0), Boundary(last)]. Bin n maps to
+//
+//	Boundary(0) + cdf(n) * (Boundary(last) - Boundary(0))
+//
+// where cdf(n) is the fraction of counts in the bins 0 to n. If all counts
+// are zero, every bin maps to Boundary(0). An empty Bin has no range to
+// spread over and maps its single bin to NaN, like Quantize.
+//
+// EqualizationMap panics if counts does not have one entry per bin number.
+func (bin *Bin) EqualizationMap(counts []int) []float64 {
+	if err := bin.checkCounts(counts); err != nil {
+		panic(err.Error())
+	}
+	if bin.empty {
+		return []float64{math.NaN()}
+	}
+
+	lo, hi := bin.boundaries[0], bin.boundaries[len(bin.boundaries)-1]
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	mapping := make([]float64, len(counts))
+	cumulative := 0
+	for n, c := range counts {
+		cumulative += c
+		mapping[n] = lo
+		if total > 0 {
+			mapping[n] += float64(cumulative) / float64(total) * (hi - lo)
+		}
+	}
+	return mapping
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"math"
+	"testing"
+)
+
+func cmpFloatSlice(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i, x := range a {
+		if x != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMergeToMinCount(t *testing.T) {
+	bin, _ := New([]float64{0, 1, 2, 3, 4, 5})
+
+	reduced, merged, err := bin.MergeToMinCount([]int{7, 2, 9, 1, 3, 6, 1}, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Bin 3 (1) merges into its smaller neighbour 4 (3), bin 1 (2) into its
+	// only proper neighbour and finally the merged 3-4 bin (4) into 5 (6).
+	expectedBoundaries := []float64{0, 2, 5}
+	if !cmpFloatSlice(reduced.boundaries, expectedBoundaries) {
+		t.Errorf("Expected boundaries\n%v but got\n%v\n", expectedBoundaries, reduced.boundaries)
+	}
+	expectedCounts := []int{7, 11, 10, 1}
+	if !cmpIntSlice(merged, expectedCounts) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expectedCounts, merged)
+	}
+
+	if _, _, err := bin.MergeToMinCount([]int{0, 1, 1, 1, 1, 0, 0}, 5); err == nil {
+		t.Errorf("Expected error when proper bins hold less than minCount")
+	}
+	if _, _, err := bin.MergeToMinCount([]int{1, 2}, 1); err == nil {
+		t.Errorf("Expected error on counts length mismatch")
+	}
+}
+
+func TestSmoothCounts(t *testing.T) {
+	counts := []int{3, 0, 6, 0, 3}
+
+	expected := []float64{1.5, 3, 2, 3, 1.5}
+	if out := SmoothCounts(counts, 3); !cmpFloatSlice(out, expected) {
+		t.Errorf("Expected window 3 to smooth to\n%v but got\n%v\n", expected, out)
+	}
+
+	expected = []float64{3, 0, 6, 0, 3}
+	if out := SmoothCounts(counts, 1); !cmpFloatSlice(out, expected) {
+		t.Errorf("Expected window 1 to keep counts\n%v but got\n%v\n", expected, out)
+	}
+
+	expected = []float64{1.5, 3, 3, 1.5, 3}
+	if out := SmoothCounts(counts, 2); !cmpFloatSlice(out, expected) {
+		t.Errorf("Expected window 2 to smooth to\n%v but got\n%v\n", expected, out)
+	}
+}
+
+func TestSearchWithCount(t *testing.T) {
+	bin, _ := New([]float64{0, 1, 2})
+	counts := []int{4, 5, 6, 7}
+
+	testData := map[float64][2]int{
+		-1:  {0, 4},
+		0.5: {1, 5},
+		1:   {2, 6},
+		2:   {3, 7},
+	}
+
+	for data, exp := range testData {
+		index, count := bin.SearchWithCount(data, counts)
+		if index != exp[0] || count != exp[1] {
+			t.Errorf("Expected %f to give bin %d with count %d but got %d with %d\n", data, exp[0], exp[1], index, count)
+		}
+	}
+}
+
+func TestAutocorrelation(t *testing.T) {
+	// A comb with a peak every 2 bins
+	acf := Autocorrelation([]int{2, 0, 2, 0, 2, 0}, 10)
+
+	expected := []float64{1, -5.0 / 6, 4.0 / 6, -3.0 / 6, 2.0 / 6, -1.0 / 6}
+	if !cmpFloatSlice(acf, expected) {
+		t.Errorf("Expected autocorrelation\n%v but got\n%v\n", expected, acf)
+	}
+
+	if acf := Autocorrelation([]int{3, 3, 3}, 1); !cmpFloatSlice(acf, []float64{0, 0}) {
+		t.Errorf("Expected zero autocorrelation for constant counts but got %v", acf)
+	}
+}
+
+func TestCountRange(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	values := []float64{-5, 1, 9, 11, 15, 19, 21, 29, 35}
+
+	counts, err := bin.CountRange(values, 9, 21)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []int{0, 1, 3, 1, 0}
+	if !cmpIntSlice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+
+	if _, err := bin.CountRange(values, 21, 9); err == nil {
+		t.Errorf("Expected error when lo > hi")
+	}
+}
+
+func TestDiffMatrix(t *testing.T) {
+	matrix := DiffMatrix([][]int{
+		{1, 1, 0},
+		{2, 2, 0},
+		{0, 0, 5},
+		{1, 0, 1},
+		{0, 0, 0},
+	})
+
+	expected := [][]float64{
+		{0, 0, 1, 0.5, 1},
+		{0, 0, 1, 0.5, 1},
+		{1, 1, 0, 0.31127812445913283, 1},
+		{0.5, 0.5, 0.31127812445913283, 0, 1},
+		{1, 1, 1, 1, 0},
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if math.Abs(matrix[i][j]-expected[i][j]) > 1e-12 {
+				t.Errorf("Expected divergence %g between %d and %d but got %g", expected[i][j], i, j, matrix[i][j])
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic on histograms of different length")
+		}
+	}()
+	DiffMatrix([][]int{{1, 2}, {1}})
+}
+
+func TestKSStatistic(t *testing.T) {
+	bin, _ := New([]float64{0, 0.25, 0.5, 0.75, 1})
+	uniformCDF := func(x float64) float64 { return math.Max(0, math.Min(1, x)) }
+
+	if d := bin.KSStatistic([]int{0, 10, 10, 10, 10, 0}, uniformCDF); d != 0 {
+		t.Errorf("Expected statistic 0 for uniform counts but got %f", d)
+	}
+	if d := bin.KSStatistic([]int{0, 20, 10, 5, 5, 0}, uniformCDF); d != 0.25 {
+		t.Errorf("Expected statistic 0.25 but got %f", d)
+	}
+	if d := bin.KSStatistic(make([]int, 6), uniformCDF); !math.IsNaN(d) {
+		t.Errorf("Expected NaN for empty counts but got %f", d)
+	}
+}
+
+func TestTotalVariation(t *testing.T) {
+	testData := []struct {
+		p, q     []int
+		expected float64
+	}{
+		{[]int{1, 1, 0}, []int{2, 2, 0}, 0},
+		{[]int{1, 0}, []int{0, 3}, 1},
+		{[]int{1, 1, 2}, []int{1, 0, 3}, 0.25},
+		{[]int{0, 0}, []int{0, 0}, 0},
+		{[]int{0, 0}, []int{1, 0}, 1},
+	}
+
+	for _, d := range testData {
+		out, err := TotalVariation(d.p, d.q)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if out != d.expected {
+			t.Errorf("Expected distance %f between %v and %v but got %f", d.expected, d.p, d.q, out)
+		}
+	}
+
+	if _, err := TotalVariation([]int{1}, []int{1, 2}); err == nil {
+		t.Errorf("Expected error on length mismatch")
+	}
+}
+
+func TestEqualizationMap(t *testing.T) {
+	bin, _ := New([]float64{0, 25, 50, 75, 100})
+
+	// Most values are dark; equalization spreads them out
+	mapping := bin.EqualizationMap([]int{0, 6, 2, 1, 1, 0})
+	expected := []float64{0, 60, 80, 90, 100, 100}
+	if !cmpFloatSlice(mapping, expected) {
+		t.Errorf("Expected mapping\n%v but got\n%v\n", expected, mapping)
+	}
+
+	if mapping := bin.EqualizationMap(make([]int, 6)); !cmpFloatSlice(mapping, make([]float64, 6)) {
+		t.Errorf("Expected empty counts to map to the first boundary but got %v", mapping)
+	}
+}
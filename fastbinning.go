@@ -17,8 +17,14 @@ limitations under the License.
 package fastbinning
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"sort"
+	"strconv"
+	"sync/atomic"
 )
 
 // Binnning for non-uniform bins in asymtotically linear time
@@ -28,84 +34,506 @@ import (
 
 type Bin struct {
 	boundaries          []float64 // must be monotonically increasing
+	opts                Options
 	uniformBinWidth     float64
 	histogram           []int
 	cumulativeHistogram []int
+	uniform             bool // boundaries are uniform up to uniformTolerance
+
+	// Uniform bin width requested with NewWithBinWidth; 0 for the default
+	fixedUniformBinWidth float64
+
+	// Accumulated data, see Accumulate
+	counts           []int64
+	cumulativeCounts atomic.Pointer[[]int64] // running totals of counts; nil if outdated
+	boundaryHits     []int64                 // values on each boundary, see PrometheusBuckets
+	binMin, binMax   []float64               // see AccumulateTracked
+	weights          []float64               // see AccumulateWeighted
+
+	// Names of the bins, see SetLabels
+	labels []string
+
+	// Searches per branch, see Options.CollectBranchStats; nil if disabled
+	branchStats *[4]atomic.Int64
+
+	// Values moved into a proper bin, see Options.Clamp; nil if disabled
+	clamped *atomic.Int64
+
+	// Created by NewSafe without boundaries
+	empty bool
+
+	// Optional fused lookup table, see NewFast
+	fast         bool
+	uniformIndex []uniformBin
 }
 
+// uniformBin holds what Search needs to know about a uniform bin: the index
+// of its first boundary and how many boundaries it contains
+type uniformBin struct {
+	start, count int
+}
+
+// uniformTolerance is how far, relative to the uniform bin width, boundaries
+// may deviate from the uniform bin edges for the Bin to count as uniform.
+// Anything below 1/2 guarantees the uniform bin number is off by at most one
+// from the bin number; we stay far below to only catch truly uniform bins.
+const uniformTolerance = 1e-9
+
 // Create a new Bin and run the precalculation step
-// boundaries must be monotonically increasing, otherwise
+// boundaries must be finite and monotonically increasing, otherwise
 // we return an error
 //
 // The preparation step runs in linear time and space on the number
 // of boundaries.
+//
+// The boundaries are copied, so the caller may reuse the slice afterwards.
+// Signed zeros are kept as given but compare equal, so values of -0 and 0
+// always share a bin and -0 and 0 cannot both be boundaries.
 func New(boundaries []float64) (*Bin, error) {
-	// Ensure boundaries are monotonically increasing
-	for i, b := range boundaries[1:] {
-		if boundaries[i] >= b {
-			return nil, fmt.Errorf("boundaries must be monotonically sorted. Found %f >= %f at index %d and %d", boundaries[i], b, i-1, i)
-		}
+	return newBin(append([]float64(nil), boundaries...), Options{})
+}
+
+// Options change how a Bin maps values to bins. The zero value gives the
+// behavior of New.
+type Options struct {
+	// OpenEnded makes the first and last proper bins unbounded: values left
+	// of the first boundary are binned to 1 and values at or right of the
+	// last boundary to len(boundaries)-1. Search then never returns the
+	// underflow or overflow bin.
+	OpenEnded bool
+
+	// ClosedUpper makes the last proper bin include the last boundary, so
+	// that the largest value of a closed domain [Boundary(0),
+	// Boundary(last)] is not binned to the overflow. Only values above the
+	// last boundary are then overflow.
+	ClosedUpper bool
+
+	// Clamp bins values like OpenEnded but also counts how many values were
+	// moved from the underflow or overflow into a proper bin, see
+	// ClampedCount. Counting costs an atomic increment per clamped value.
+	Clamp bool
+
+	// CollectBranchStats makes the Bin count which branch of the algorithm
+	// each search inside the boundaries takes, see BranchStats. Counting
+	// costs an atomic increment per search.
+	CollectBranchStats bool
+
+	// Epsilon makes values that lie at most Epsilon below a boundary bin as
+	// if they were equal to it, so boundaries and values computed with
+	// different rounding errors still agree. This trades strictness for
+	// robustness: bins narrower than Epsilon can no longer be hit from
+	// below. Epsilon must be finite and not negative; the default of 0
+	// compares exactly.
+	Epsilon float64
+}
+
+// NewWithOptions works like New but creates a Bin with the given options
+func NewWithOptions(boundaries []float64, opts Options) (*Bin, error) {
+	return newBin(append([]float64(nil), boundaries...), opts)
+}
+
+// newBin works like NewWithOptions but takes ownership of boundaries
+// instead of copying them
+func newBin(boundaries []float64, opts Options) (*Bin, error) {
+	if err := validateBoundaries(boundaries); err != nil {
+		return nil, err
+	}
+	if eps := opts.Epsilon; !(eps >= 0) || math.IsInf(eps, 1) {
+		return nil, fmt.Errorf("epsilon must be finite and not negative. Found %f", eps)
 	}
 
 	bin := &Bin{
 		boundaries: boundaries,
+		opts:       opts,
+	}
+	if opts.CollectBranchStats {
+		bin.branchStats = new([4]atomic.Int64)
+	}
+	if opts.Clamp {
+		bin.clamped = new(atomic.Int64)
 	}
 
-	bin.precalculation()
+	if err := bin.precalculation(bin.defaultUniformBinWidth()); err != nil {
+		return nil, err
+	}
 
 	return bin, nil
 }
 
+func validateBoundaries(boundaries []float64) error {
+	if len(boundaries) < 2 {
+		return fmt.Errorf("need at least 2 boundaries but got %d", len(boundaries))
+	}
+
+	// The uniform bins need a finite total width
+	for i, b := range boundaries {
+		if err := checkFinite(b); err != nil {
+			return fmt.Errorf("%w at index %d", err, i)
+		}
+	}
+
+	// Ensure boundaries are monotonically increasing
+	for i, b := range boundaries[1:] {
+		if boundaries[i] >= b {
+			return fmt.Errorf("boundaries must be monotonically sorted. Found %f >= %f at index %d and %d", boundaries[i], b, i, i+1)
+		}
+	}
+	return nil
+}
+
+func checkFinite(boundary float64) error {
+	if math.IsNaN(boundary) || math.IsInf(boundary, 0) {
+		return fmt.Errorf("boundaries must be finite. Found %f", boundary)
+	}
+	return nil
+}
+
 func (bin *Bin) Boundary(i int) float64 {
 	return bin.boundaries[i]
 }
 
-func (bin *Bin) precalculation() {
+// Boundaries returns a copy of all boundaries. Modifying the copy does not
+// affect the Bin.
+func (bin *Bin) Boundaries() []float64 {
+	return append([]float64(nil), bin.boundaries...)
+}
+
+// BoundariesView returns the boundaries without copying them, for passing
+// large Bins to code that only reads them. The slice is the Bin's own:
+// modifying it corrupts the Bin and its searches. Use Boundaries to get a
+// copy that is safe to modify. Insert and Remove replace the boundaries, so
+// a view taken before shows the old ones.
+func (bin *Bin) BoundariesView() []float64 {
+	return bin.boundaries[:len(bin.boundaries):len(bin.boundaries)]
+}
+
+// Equal reports whether both Bins have the same boundaries and options and
+// thus bin every value the same. The precalculated fields are derived from
+// the boundaries and need not be compared. CollectBranchStats only affects
+// diagnostics and is ignored.
+func (bin *Bin) Equal(other *Bin) bool {
+	if bin == nil || other == nil {
+		return bin == other
+	}
+	a, b := bin.opts, other.opts
+	a.CollectBranchStats, b.CollectBranchStats = false, false
+	if a != b || len(bin.boundaries) != len(other.boundaries) {
+		return false
+	}
+	for i, b := range bin.boundaries {
+		if b != other.boundaries[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a 64-bit FNV-1a hash of the boundaries, suitable as a cache
+// key for results computed from a Bin. It is stable across processes and
+// platforms. Only the boundaries are hashed since everything else is
+// derived from them; Bins that are Equal have the same Hash.
+func (bin *Bin) Hash() uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, b := range bin.boundaries {
+		if b == 0 {
+			// -0 and 0 are equal boundaries but have different bits
+			b = 0
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(b))
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// UniformBinWidth returns the width of the uniform bins used to accelerate
+// Search. A width that is large compared to the spacing of boundaries means
+// many boundaries share a uniform bin, making searches slower.
+func (bin *Bin) UniformBinWidth() float64 {
+	return bin.uniformBinWidth
+}
+
+// ClampedCount returns how many searches were moved from the underflow or
+// overflow into the first or last proper bin. It is 0 unless the Bin was
+// created with Options.Clamp.
+func (bin *Bin) ClampedCount() int {
+	if bin.clamped == nil {
+		return 0
+	}
+	return int(bin.clamped.Load())
+}
+
+// CumulativeBoundaryHistogram returns a copy of the running totals of the
+// boundary histogram, starting at 1 for the excluded first boundary. Entry i
+// is the index of the first boundary in uniform bin i+1, which is where
+// Search starts comparing.
+func (bin *Bin) CumulativeBoundaryHistogram() []int {
+	return append([]int(nil), bin.cumulativeHistogram...)
+}
+
+// BranchStats returns how many searches inside the boundaries took each
+// branch of the algorithm: uniform bins holding no, one or two boundaries,
+// and the binary search fallback for more. The fallback is slower, so a
+// large share of it suggests a narrower uniform bin width. Searches of
+// Bins with uniform boundaries are resolved like the one boundary branch
+// and counted there. All counts are zero unless the Bin was created with
+// Options.CollectBranchStats.
+func (bin *Bin) BranchStats() (h0, h1, h2, fallback int) {
+	if bin.branchStats == nil {
+		return 0, 0, 0, 0
+	}
+	s := bin.branchStats
+	return int(s[0].Load()), int(s[1].Load()), int(s[2].Load()), int(s[3].Load())
+}
+
+// BoundaryHistogram returns a copy of the number of interior boundaries in
+// each uniform bin. Search takes constant time on average as long as these
+// numbers stay small; long runs of large entries suggest a narrower
+// uniform bin width, see NewWithBinWidth.
+func (bin *Bin) BoundaryHistogram() []int {
+	return append([]int(nil), bin.histogram...)
+}
+
+// Interval is the half-open interval [Lo, Hi) covered by a bin
+type Interval struct {
+	Lo, Hi float64
+}
+
+// Bins calls yield with the bin number and interval of every proper bin,
+// from left to right, until yield returns false. It can be used with range:
+//
+//	for n, interval := range bin.Bins {
+//		fmt.Println(n, interval.Lo, interval.Hi)
+//	}
+func (bin *Bin) Bins(yield func(int, Interval) bool) {
+	for n := 1; n < len(bin.boundaries); n++ {
+		if !yield(n, Interval{bin.boundaries[n-1], bin.boundaries[n]}) {
+			return
+		}
+	}
+}
+
+// MemoryBytes estimates the memory the Bin holds: its boundaries, the
+// histograms of the precalculation and, if present, the fast lookup table,
+// accumulated data and labels. Labels count with their string headers,
+// since those make up the array backing the labels, plus their bytes. It
+// excludes the headers of the Bin's own slices and the Bin struct itself,
+// so it is a lower bound useful for budgeting many Bins.
+func (bin *Bin) MemoryBytes() int {
+	intSize := strconv.IntSize / 8
+	bytes := 8*len(bin.boundaries) + intSize*(len(bin.histogram)+len(bin.cumulativeHistogram))
+	bytes += 2 * intSize * len(bin.uniformIndex)
+	bytes += 8 * (len(bin.counts) + len(bin.boundaryHits) + len(bin.binMin) + len(bin.binMax) + len(bin.weights))
+	if totals := bin.cumulativeCounts.Load(); totals != nil {
+		bytes += 8 * len(*totals)
+	}
+	for _, label := range bin.labels {
+		bytes += 2*intSize + len(label)
+	}
+	return bytes
+}
+
+// Center returns the representative value of a bin: the midpoint of a
+// proper bin, the first boundary for the underflow and the last boundary for
+// the overflow. An empty Bin has no representative values, so Center
+// returns NaN.
+func (bin *Bin) Center(binNumber int) float64 {
+	if bin.empty {
+		return math.NaN()
+	}
+	switch bin.Kind(binNumber) {
+	case Underflow:
+		return bin.boundaries[0]
+	case Overflow:
+		return bin.boundaries[len(bin.boundaries)-1]
+	}
+	lo, hi := bin.boundaries[binNumber-1], bin.boundaries[binNumber]
+	return lo + (hi-lo)/2
+}
+
+// Insert adds a new boundary to the Bin and redoes the precalculation.
+// Inserting a boundary that already exists or is not finite returns an
+// error. Accumulated counts of the bin being split are divided
+// proportionally between its two parts.
+func (bin *Bin) Insert(boundary float64) error {
+	if bin.empty {
+		return fmt.Errorf("cannot insert into an empty Bin; create a new one from at least 2 boundaries")
+	}
+	if err := checkFinite(boundary); err != nil {
+		return err
+	}
+
+	i := sort.SearchFloat64s(bin.boundaries, boundary)
+	if i < len(bin.boundaries) && bin.boundaries[i] == boundary {
+		return fmt.Errorf("boundary %f already exists at index %d", boundary, i)
+	}
+
+	// Check the new range before changing anything, so a failing Insert
+	// leaves the Bin as it was
+	lo := math.Min(boundary, bin.boundaries[0])
+	hi := math.Max(boundary, bin.boundaries[len(bin.boundaries)-1])
+	width := bin.fixedUniformBinWidth
+	if width == 0 {
+		width = (hi - lo) / float64(len(bin.boundaries))
+	}
+	if err := checkUniformBins(hi-lo, width); err != nil {
+		return err
+	}
+
+	bin.splitCounts(i, boundary)
+	bin.labels = nil
+
+	boundaries := make([]float64, 0, len(bin.boundaries)+1)
+	boundaries = append(boundaries, bin.boundaries[:i]...)
+	boundaries = append(boundaries, boundary)
+	boundaries = append(boundaries, bin.boundaries[i:]...)
+	bin.boundaries = boundaries
+	return bin.reprecalculate()
+}
+
+// Remove deletes the boundary at index and redoes the precalculation,
+// merging the bins on both sides of it; removing the first or last boundary
+// merges the outermost proper bin into the underflow or overflow.
+// Accumulated counts and tracked extremes of both bins are combined. A Bin
+// keeps at least two boundaries, and labels are removed as with Insert.
+func (bin *Bin) Remove(index int) error {
+	if index < 0 || index >= len(bin.boundaries) {
+		return fmt.Errorf("boundary index %d out of range [0, %d)", index, len(bin.boundaries))
+	}
+	if len(bin.boundaries) <= 2 {
+		return fmt.Errorf("cannot remove a boundary from %d boundaries; at least 2 must remain", len(bin.boundaries))
+	}
+
+	bin.mergeCounts(index)
+	bin.labels = nil
+
+	boundaries := make([]float64, 0, len(bin.boundaries)-1)
+	boundaries = append(boundaries, bin.boundaries[:index]...)
+	boundaries = append(boundaries, bin.boundaries[index+1:]...)
+	bin.boundaries = boundaries
+	return bin.reprecalculate()
+}
+
+// reprecalculate redoes the precalculation after the boundaries changed,
+// keeping a uniform bin width requested with NewWithBinWidth
+func (bin *Bin) reprecalculate() error {
+	width := bin.fixedUniformBinWidth
+	if width == 0 {
+		width = bin.defaultUniformBinWidth()
+	}
+	return bin.precalculation(width)
+}
+
+// defaultUniformBinWidth divides the range of the boundaries into as many
+// uniform bins as there are proper bins
+func (bin *Bin) defaultUniformBinWidth() float64 {
+	m := len(bin.boundaries) - 1
+	return (bin.boundaries[m] - bin.boundaries[0]) / float64(m)
+}
+
+// checkUniformBins returns an error unless a range of totalWidth can be
+// divided into uniform bins of width uniformBinWidth. Extreme boundaries
+// far apart overflow the total width, and a zero or denormal width that
+// underflowed makes the uniform bin number infinite.
+func checkUniformBins(totalWidth, uniformBinWidth float64) error {
+	if math.IsInf(totalWidth, 0) {
+		return fmt.Errorf("the range of the boundaries is too wide to be represented as float64")
+	}
+	if !(uniformBinWidth > 0) || math.IsInf(uniformBinWidth, 0) {
+		return fmt.Errorf("uniform bin width must be positive and finite but is %g", uniformBinWidth)
+	}
+	if totalWidth/uniformBinWidth > maxUniformBins {
+		return fmt.Errorf("uniform bin width %g divides the range of width %g into more than %d uniform bins", uniformBinWidth, totalWidth, maxUniformBins)
+	}
+	return nil
+}
+
+// precalculation prepares the Bin for Search. It errors instead of
+// producing a Bin that would panic on Search, see checkUniformBins.
+func (bin *Bin) precalculation(uniformBinWidth float64) error {
 	// Number of bins; 1 bin would have 2 boundaries, 2 bins have 3 boundaries, etc.
 	m := len(bin.boundaries) - 1
 
 	// Step 1 - set up uniform bins
 	totalWidth := bin.boundaries[m] - bin.boundaries[0]
+	if err := checkUniformBins(totalWidth, uniformBinWidth); err != nil {
+		return err
+	}
 
 	// We create uniform bins within the range in question. This will help us to
 	// find the actual bin an element belongs to withuot having to to a binary
 	// search for every element. In the precalculation step we build a histogram
 	// of the boundaries within those uniform bins.
-	bin.uniformBinWidth = totalWidth / float64(m)
+	// By default there are as many uniform bins as bins, see
+	// defaultUniformBinWidth. We do not derive their number from the width:
+	// rounding in totalWidth/m can make it slightly too narrow to fit m times
+	// into totalWidth.
+	bin.uniformBinWidth = uniformBinWidth
+	u := m
+	if bin.fixedUniformBinWidth != 0 {
+		// A width that does not divide the range evenly gets a partial last bin
+		u = int(math.Ceil(totalWidth / uniformBinWidth))
+		if u < 1 {
+			u = 1
+		}
+	}
 
 	// Step 2 - histogram of non-uniform bins in uniform bins
-	bin.histogram = make([]int, m)
+	bin.histogram = make([]int, u)
 
 	// Unform bins are numbered as follows:
 	// 0   -> (-inf, b[0])
-	// 1   -> [b[0], b[1])
+	// 1   -> [b[0], b[0]+w)
 	// ...
-	// m+1 -> [b[m], inf)
-	uniformBinNumber := 1
-
-	// We use the fact that boundaries are sorted.
-	// The lowest bound for both the uniform bins and the non-uniform bins is the same
-	lowestBound := bin.boundaries[0]
-
-	// We exclude the extreme boundaries b[0] and b[m] as required by the algorithm
+	// u+1 -> [b[m], inf)
+	//
+	// We exclude the extreme boundaries b[0] and b[m] as required by the algorithm.
+	// Each boundary goes to the uniform bin Search computes for it. Since that
+	// computation is monotonic, even under rounding, every boundary in an
+	// earlier uniform bin than a value is below the value and every boundary
+	// in a later one is above it.
 	for _, b := range bin.boundaries[1:m] {
-		for b > lowestBound+bin.uniformBinWidth {
-			// b is outside of the current uniform bin. Find the next unform bin
-			lowestBound += bin.uniformBinWidth
-			uniformBinNumber += 1
-		}
-
-		// The current boundary is in uniform bin uniformBinNumber; count it towards
-		// the histogram
-		bin.histogram[uniformBinNumber-1] += 1
+		bin.histogram[bin.uniformBinNumber(b)-1] += 1
 	}
 
 	// Step 3 - cumulative histogram
-	bin.cumulativeHistogram = make([]int, m+1) // We cumulate on uniform boundaries not bins, thus there are m+1
+	bin.cumulativeHistogram = make([]int, u+1) // We cumulate on uniform boundaries not bins, thus there are u+1
 	bin.cumulativeHistogram[0] = 1             // We start at 1 since we excluded the extreme boundaries in step 2
 	for i, h := range bin.histogram {
 		bin.cumulativeHistogram[i+1] = bin.cumulativeHistogram[i] + h
 	}
+
+	if bin.fast {
+		bin.uniformIndex = make([]uniformBin, u)
+		for i, h := range bin.histogram {
+			bin.uniformIndex[i] = uniformBin{start: bin.cumulativeHistogram[i], count: h}
+		}
+	}
+
+	// Step 4 - detect uniform boundaries, which coincide with the uniform
+	// bins and allow Search to skip the histogram lookup
+	bin.uniform = u == m
+	for i, b := range bin.boundaries {
+		if math.Abs(b-(bin.boundaries[0]+float64(i)*bin.uniformBinWidth)) > uniformTolerance*bin.uniformBinWidth {
+			bin.uniform = false
+			break
+		}
+	}
+	return nil
+}
+
+// uniformBinNumber returns the uniform bin value lies in, given that it lies
+// within the boundaries. The result is limited to [1, u] for u uniform bins:
+// rounding in the division can push values just below the last boundary
+// into the non-existing uniform bin u+1.
+func (bin *Bin) uniformBinNumber(value float64) int {
+	n := int((value-bin.boundaries[0])/bin.uniformBinWidth) + 1
+	if u := len(bin.histogram); n > u {
+		return u
+	} else if n < 1 {
+		return 1
+	}
+	return n
 }
 
 // Search returns the bin-number of a value in a prepared Bin
@@ -119,27 +547,104 @@ func (bin *Bin) precalculation() {
 // A return of n means the value lies within the interval [bin.Boundary[n-1], bin.Boundary[n])
 // meaning 1 represents the left-most proper interval and len(bin.Boundary)-1 represents the
 // right most proper interval.
+// Since the intervals are half-open, a value equal to a boundary always lies
+// in the bin right of it, no matter which branch of the search finds it.
+// NaN lies in no bin; Search bins it to the overflow like values right of
+// the last boundary, and the options then apply to it as to any overflow.
+// Use SearchE to get an error for NaN instead.
 //
 // A Search runs in O(1) time on average, as proved by O. Cadenas and G. M. Megson
 // and O(1) space.
 func (bin *Bin) Search(value float64) int {
 	if bin.uniformBinWidth <= 0 {
-		panic("Bin needs to be created with New")
+		if bin.empty {
+			return 0
+		}
+		panic(ErrUnprepared.Error())
 	}
 
+	n := bin.search(value)
+	if bin.opts != (Options{}) {
+		n = bin.applyOptions(n, value)
+	}
+	return n
+}
+
+// applyOptions adjusts the bin number n of value, as found without any
+// options, to the options of bin and counts clamped values
+func (bin *Bin) applyOptions(n int, value float64) int {
+	n, clamped := bin.mapOptions(n, value)
+	if clamped {
+		bin.clamped.Add(1)
+	}
+	return n
+}
+
+// mapOptions works like applyOptions without side effects. It additionally
+// reports whether Clamp moved value into a proper bin.
+func (bin *Bin) mapOptions(n int, value float64) (int, bool) {
+	if eps := bin.opts.Epsilon; eps > 0 && n < len(bin.boundaries) && bin.boundaries[n]-value <= eps {
+		// value snaps onto the next boundary up
+		n++
+	}
+	if bin.opts.ClosedUpper && n == len(bin.boundaries) && value <= bin.boundaries[n-1] {
+		n--
+	}
+	if bin.opts.Clamp {
+		if n == 0 {
+			return 1, true
+		} else if n == len(bin.boundaries) {
+			return n - 1, true
+		}
+	}
+	if bin.opts.OpenEnded {
+		if n == 0 {
+			return 1, false
+		} else if n == len(bin.boundaries) {
+			return n - 1, false
+		}
+	}
+	return n, false
+}
+
+// search works like Search but ignores the options of bin
+func (bin *Bin) search(value float64) int {
 	if value < bin.boundaries[0] {
 		return 0
-	} else if value >= bin.boundaries[len(bin.boundaries)-1] {
+	} else if !(value < bin.boundaries[len(bin.boundaries)-1]) {
+		// Also catches NaN, which fails every comparison
 		return len(bin.boundaries)
 	}
 
 	// We now know bin.boundaries[0] <= value < bin.boundaries[m]
-	uniformBinNumber := int((value-bin.boundaries[0])/bin.uniformBinWidth) + 1
+	uniformBinNumber := bin.uniformBinNumber(value)
 
-	h := bin.histogram[uniformBinNumber-1]
+	if bin.uniform {
+		if bin.branchStats != nil {
+			bin.branchStats[1].Add(1)
+		}
+		// The uniform bin number is the bin number, up to rounding
+		if value < bin.boundaries[uniformBinNumber-1] {
+			return uniformBinNumber - 1
+		} else if value >= bin.boundaries[uniformBinNumber] {
+			return uniformBinNumber + 1
+		}
+		return uniformBinNumber
+	}
 
 	// if r is used as an index we need to -1 since we're 0-indexing
-	r := bin.cumulativeHistogram[uniformBinNumber-1]
+	var h, r int
+	if bin.uniformIndex != nil {
+		u := bin.uniformIndex[uniformBinNumber-1]
+		h, r = u.count, u.start
+	} else {
+		h = bin.histogram[uniformBinNumber-1]
+		r = bin.cumulativeHistogram[uniformBinNumber-1]
+	}
+
+	if bin.branchStats != nil {
+		bin.branchStats[min(h, 3)].Add(1)
+	}
 
 	switch h {
 	case 0: // case h = 0
@@ -164,3 +669,497 @@ func (bin *Bin) Search(value float64) int {
 		return r + sort.Search(h, func(i int) bool { return value < bin.boundaries[r+i] })
 	}
 }
+
+// SearchRange returns the first and last bin number, inclusive, of the bins
+// the half-open interval [a, b) intersects. An empty interval with a == b
+// returns the bin of a for both. It errors if a > b or either is NaN.
+func (bin *Bin) SearchRange(a, b float64) (first, last int, err error) {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return 0, 0, ErrNaN
+	}
+	if a > b {
+		return 0, 0, fmt.Errorf("range start %f is larger than its end %f", a, b)
+	}
+
+	first = bin.Search(a)
+	if a == b {
+		return first, first, nil
+	}
+	// The largest value in [a, b) is the float right below b
+	return first, bin.Search(math.Nextafter(b, math.Inf(-1))), nil
+}
+
+// SearchHint works like Search but first checks whether value lies in bin
+// hintBin or one of its direct neighbours, typically the result of the
+// previous search. This skips the uniform bin arithmetic for queries with
+// strong locality. The result is always the same as that of Search; a wrong
+// hint only costs the extra comparisons.
+func (bin *Bin) SearchHint(value float64, hintBin int) int {
+	for _, n := range [3]int{hintBin, hintBin - 1, hintBin + 1} {
+		if bin.inBin(n, value) {
+			if bin.opts != (Options{}) {
+				return bin.applyOptions(n, value)
+			}
+			return n
+		}
+	}
+	return bin.Search(value)
+}
+
+// SearchApprox works like Search but skips the comparisons with the
+// boundaries inside the uniform bin value lies in. It returns the number of
+// boundaries left of that uniform bin, which is smaller than the result of
+// Search by up to the number of boundaries in the uniform bin, see
+// BoundaryHistogram. For uniform boundaries the uniform bin number is used
+// directly, which is off by one at most where rounding puts a value on the
+// wrong side of a boundary. Values outside the boundaries are binned
+// exactly. Use ApproxError to check whether the approximation is good
+// enough for some data.
+func (bin *Bin) SearchApprox(value float64) int {
+	if bin.uniformBinWidth <= 0 {
+		if bin.empty {
+			return 0
+		}
+		panic(ErrUnprepared.Error())
+	}
+
+	n := bin.searchApprox(value)
+	if bin.opts != (Options{}) {
+		n = bin.applyOptions(n, value)
+	}
+	return n
+}
+
+// searchApprox works like SearchApprox but ignores the options of bin
+func (bin *Bin) searchApprox(value float64) int {
+	if !(value < bin.boundaries[len(bin.boundaries)-1]) {
+		// NaN goes to the overflow like in Search
+		return len(bin.boundaries)
+	} else if value < bin.boundaries[0] {
+		return 0
+	}
+
+	n := bin.uniformBinNumber(value)
+	if !bin.uniform {
+		n = bin.cumulativeHistogram[n-1]
+	}
+	return n
+}
+
+// ApproxError compares SearchApprox with Search on values. It returns the
+// largest difference between the bin numbers and the number of values
+// SearchApprox bins differently. The options of bin are ignored, so
+// measuring does not count clamped values.
+func (bin *Bin) ApproxError(values []float64) (maxError, misbinned int) {
+	if bin.uniformBinWidth <= 0 {
+		if bin.empty {
+			return 0, 0
+		}
+		panic(ErrUnprepared.Error())
+	}
+
+	for _, v := range values {
+		if d := bin.search(v) - bin.searchApprox(v); d != 0 {
+			misbinned++
+			if d < 0 {
+				d = -d
+			}
+			if d > maxError {
+				maxError = d
+			}
+		}
+	}
+	return maxError, misbinned
+}
+
+// inBin reports whether value lies in bin n, ignoring the options of bin
+func (bin *Bin) inBin(n int, value float64) bool {
+	if n < 0 || n > len(bin.boundaries) {
+		return false
+	}
+	return (n == 0 || value >= bin.boundaries[n-1]) && (n == len(bin.boundaries) || value < bin.boundaries[n])
+}
+
+// SearchOr works like Search but returns underValue for values left of the
+// first boundary and overValue for values at or right of the last boundary.
+func (bin *Bin) SearchOr(value float64, underValue, overValue int) int {
+	n := bin.Search(value)
+	switch bin.Kind(n) {
+	case Underflow:
+		return underValue
+	case Overflow:
+		return overValue
+	default:
+		return n
+	}
+}
+
+// maxStringBoundaries is the number of boundaries up to which String lists
+// all boundaries
+const maxStringBoundaries = 16
+
+// String summarizes the Bin for debugging: the number of proper bins, the
+// covered range, the uniform bin width and the largest number of boundaries
+// within a single uniform bin. Small Bins also list their boundaries.
+func (bin *Bin) String() string {
+	if bin.empty {
+		return "Bin{empty}"
+	} else if len(bin.boundaries) == 0 {
+		return "Bin{unprepared}"
+	}
+
+	maxH := 0
+	for _, h := range bin.histogram {
+		if h > maxH {
+			maxH = h
+		}
+	}
+
+	s := fmt.Sprintf("Bin{bins: %d, range: [%g, %g), uniformBinWidth: %g, maxUniformBinCount: %d",
+		len(bin.boundaries)-1, bin.boundaries[0], bin.boundaries[len(bin.boundaries)-1], bin.uniformBinWidth, maxH)
+	if len(bin.boundaries) <= maxStringBoundaries {
+		s += fmt.Sprintf(", boundaries: %g", bin.boundaries)
+	}
+	return s + "}"
+}
+
+// LinearSearch returns the same bin number as Search using a plain binary
+// search over the boundaries, without the precalculated histograms. It
+// runs in O(log n) time and serves as a reference to validate Search
+// against. Unlike Search it has no side effects: it neither collects branch
+// statistics nor counts clamped values.
+func (bin *Bin) LinearSearch(value float64) int {
+	n := sort.Search(len(bin.boundaries), func(i int) bool { return value < bin.boundaries[i] })
+	n, _ = bin.mapOptions(n, value)
+	return n
+}
+
+// covers reports whether value lies within [Boundary(0), Boundary(last)).
+// An empty Bin covers nothing.
+func (bin *Bin) covers(value float64) bool {
+	if bin.empty {
+		return false
+	}
+	return value >= bin.boundaries[0] && value < bin.boundaries[len(bin.boundaries)-1]
+}
+
+// Covers reports whether all values lie within the proper bins, that is
+// none of them would be binned to the underflow or overflow.
+func (bin *Bin) Covers(values []float64) bool {
+	for _, v := range values {
+		if !bin.covers(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// CoverageFraction returns the fraction of values that lie within the
+// proper bins. An empty slice is fully covered.
+func (bin *Bin) CoverageFraction(values []float64) float64 {
+	if len(values) == 0 {
+		return 1
+	}
+
+	covered := 0
+	for _, v := range values {
+		if bin.covers(v) {
+			covered++
+		}
+	}
+	return float64(covered) / float64(len(values))
+}
+
+// narrowBinRatio is the width, relative to the uniform bin width, below
+// which NarrowestBin considers a bin risky
+const narrowBinRatio = 1e-6
+
+// NarrowestBin returns the bin number and width of the narrowest proper bin.
+// risky reports whether it is narrower than narrowBinRatio times the
+// uniform bin width. Such bins crowd into a single uniform bin with their
+// neighbours, where the acceleration of Search no longer helps and rounding
+// in the uniform bin arithmetic is of the order of the bin width. An empty
+// Bin has no proper bin and returns -1, NaN and false.
+func (bin *Bin) NarrowestBin() (index int, width float64, risky bool) {
+	if bin.empty {
+		return -1, math.NaN(), false
+	}
+	index, width = 1, bin.boundaries[1]-bin.boundaries[0]
+	for n := 2; n < len(bin.boundaries); n++ {
+		if w := bin.boundaries[n] - bin.boundaries[n-1]; w < width {
+			index, width = n, w
+		}
+	}
+	return index, width, width < narrowBinRatio*bin.uniformBinWidth
+}
+
+// NearestBoundary returns the index and value of the boundary closest to
+// value. Ties go to the lower boundary. Like Search, it runs in O(1) time on
+// average since only the edges of the bin value lies in can be closest. An
+// empty Bin has no boundary and returns -1 and NaN.
+func (bin *Bin) NearestBoundary(value float64) (idx int, boundary float64) {
+	if bin.empty {
+		return -1, math.NaN()
+	}
+	n := bin.search(value)
+	if n == 0 {
+		return 0, bin.boundaries[0]
+	} else if n == len(bin.boundaries) {
+		return n - 1, bin.boundaries[n-1]
+	}
+
+	lo, hi := bin.boundaries[n-1], bin.boundaries[n]
+	if hi-value < value-lo {
+		return n, hi
+	}
+	return n - 1, lo
+}
+
+var (
+	// ErrUnprepared is returned when searching a Bin not created by New
+	ErrUnprepared = errors.New("Bin needs to be created with New")
+	// ErrNaN is returned when searching NaN, which lies in no bin
+	ErrNaN = errors.New("NaN cannot be binned")
+)
+
+// SearchE works like Search but returns an error instead of panicking on a
+// Bin that was not created with New, and on NaN values.
+func (bin *Bin) SearchE(value float64) (int, error) {
+	if bin.uniformBinWidth <= 0 && !bin.empty {
+		return 0, ErrUnprepared
+	}
+	if math.IsNaN(value) {
+		return 0, ErrNaN
+	}
+	return bin.Search(value), nil
+}
+
+// BinKind classifies the bin numbers returned by Search
+type BinKind int
+
+const (
+	// Underflow is the bin left of the first boundary
+	Underflow BinKind = iota
+	// Proper is any of the intervals between the first and the last boundary
+	Proper
+	// Overflow is the bin at or right of the last boundary
+	Overflow
+)
+
+func (kind BinKind) String() string {
+	switch kind {
+	case Underflow:
+		return "Underflow"
+	case Proper:
+		return "Proper"
+	case Overflow:
+		return "Overflow"
+	default:
+		return fmt.Sprintf("BinKind(%d)", int(kind))
+	}
+}
+
+// Kind classifies the given bin number
+func (bin *Bin) Kind(binNumber int) BinKind {
+	if binNumber <= 0 {
+		return Underflow
+	} else if binNumber >= len(bin.boundaries) {
+		return Overflow
+	}
+	return Proper
+}
+
+// SearchClassified works like Search but additionally returns whether the
+// value fell into a proper bin or into the underflow or overflow.
+func (bin *Bin) SearchClassified(value float64) (int, BinKind) {
+	n := bin.Search(value)
+	return n, bin.Kind(n)
+}
+
+// ProperBinIndex returns the zero-based index of the proper bin value lies
+// in, where 0 is the interval [Boundary(0), Boundary(1)). ok is false if
+// value lies in the underflow or overflow.
+func (bin *Bin) ProperBinIndex(value float64) (idx int, ok bool) {
+	n, kind := bin.SearchClassified(value)
+	if kind != Proper {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// SetLabels names the bins for SearchLabel. labels holds one name per bin
+// number, including the underflow and overflow, so it must have
+// len(Boundaries())+1 entries. A nil labels removes all labels. Insert
+// changes the bin numbers and therefore also removes the labels.
+func (bin *Bin) SetLabels(labels []string) error {
+	if labels == nil {
+		bin.labels = nil
+		return nil
+	}
+	if len(labels) != len(bin.boundaries)+1 {
+		return fmt.Errorf("need %d labels for %d boundaries. Found %d", len(bin.boundaries)+1, len(bin.boundaries), len(labels))
+	}
+	bin.labels = append([]string(nil), labels...)
+	return nil
+}
+
+// SearchLabel returns the label, as set with SetLabels, of the bin value lies
+// in. It returns the empty string if no labels are set.
+func (bin *Bin) SearchLabel(value float64) string {
+	n := bin.Search(value)
+	if bin.labels == nil {
+		return ""
+	}
+	return bin.labels[n]
+}
+
+// SearchResult is the bin a value was found in by SearchR. It remembers the
+// Bin it came from, so the bin number can be interpreted without it.
+type SearchResult struct {
+	bin *Bin
+	n   int
+}
+
+// SearchR works like Search but returns a SearchResult instead of a bare bin
+// number. Search avoids the extra pointer and is preferable in hot loops.
+func (bin *Bin) SearchR(value float64) SearchResult {
+	return SearchResult{bin: bin, n: bin.Search(value)}
+}
+
+// Number returns the bin number as returned by Search
+func (r SearchResult) Number() int {
+	return r.n
+}
+
+// IsUnderflow reports whether the value lies left of the first boundary
+func (r SearchResult) IsUnderflow() bool {
+	return r.bin.Kind(r.n) == Underflow
+}
+
+// IsOverflow reports whether the value lies at or right of the last boundary
+func (r SearchResult) IsOverflow() bool {
+	return r.bin.Kind(r.n) == Overflow
+}
+
+// ProperIndex returns the zero-based index of the proper bin, where 0 is the
+// interval [Boundary(0), Boundary(1)). ok is false for the underflow and
+// overflow.
+func (r SearchResult) ProperIndex() (idx int, ok bool) {
+	if r.bin.Kind(r.n) != Proper {
+		return 0, false
+	}
+	return r.n - 1, true
+}
+
+// Interval returns the interval covered by the bin. The underflow extends to
+// negative infinity and the overflow to positive infinity.
+func (r SearchResult) Interval() Interval {
+	lo, hi := math.Inf(-1), math.Inf(1)
+	if r.n > 0 {
+		lo = r.bin.boundaries[r.n-1]
+	}
+	if r.n < len(r.bin.boundaries) {
+		hi = r.bin.boundaries[r.n]
+	}
+	return Interval{lo, hi}
+}
+
+// fraction returns the relative position of value within proper bin n,
+// limited to [0, 1). Open-ended edge bins hold values outside their
+// interval, which are limited to the nearest edge.
+func (bin *Bin) fraction(n int, value float64) float64 {
+	lo, hi := bin.boundaries[n-1], bin.boundaries[n]
+	frac := (value - lo) / (hi - lo)
+	if frac < 0 {
+		return 0
+	} else if frac >= 1 {
+		return math.Nextafter(1, 0)
+	}
+	return frac
+}
+
+// SearchFraction returns the bin number of value together with the
+// relative position of value within that bin, (value - lo) / (hi - lo) for
+// the bin's interval [lo, hi). The fraction is 0 for the underflow and 1 for
+// the overflow.
+func (bin *Bin) SearchFraction(value float64) (int, float64) {
+	n, kind := bin.SearchClassified(value)
+	switch kind {
+	case Underflow:
+		return n, 0
+	case Overflow:
+		return n, 1
+	default:
+		return n, bin.fraction(n, value)
+	}
+}
+
+// SearchPacked returns the bin number of value plus the relative position
+// of value within that bin, so the integer part is the bin number and the
+// fractional part lies in [0, 1). Values in the underflow or overflow have
+// a fractional part of 0. The encoding is monotonic in value. The larger
+// the bin number, the less precise the fractional part; a fraction
+// rounding up to the next bin is reduced to the largest float64 below it.
+func (bin *Bin) SearchPacked(value float64) float64 {
+	n, kind := bin.SearchClassified(value)
+	if kind != Proper {
+		return float64(n)
+	}
+	if p := float64(n) + bin.fraction(n, value); p < float64(n+1) {
+		return p
+	}
+	return math.Nextafter(float64(n+1), float64(n))
+}
+
+// SearchPackedAll returns SearchPacked of every value as float32, ready to
+// upload to a GPU buffer. float32 holds 24 bits of precision, so the larger
+// the bin number, the less precise the fractional part; above 2^24 bins it
+// is lost entirely. A fraction rounding up to the next bin is reduced to
+// the largest float32 below it, so the integer part is always exact up to
+// 2^24.
+func (bin *Bin) SearchPackedAll(values []float64) []float32 {
+	packed := make([]float32, len(values))
+	for i, v := range values {
+		p := bin.SearchPacked(v)
+		packed[i] = float32(p)
+		if next := math.Floor(p) + 1; float64(packed[i]) >= next {
+			packed[i] = math.Nextafter32(float32(next), 0)
+		}
+	}
+	return packed
+}
+
+// SearchFloat32 returns the bin number of a float32 value, comparing it
+// against the boundaries rounded to float32. This gives the same bin as a
+// search done entirely in float32 on float32-derived boundaries.
+//
+// Note that Search(float64(value)) can differ: promoting value to float64 is
+// exact, but a float64 boundary that is not representable in float32 then
+// compares against the exact value rather than the rounded one. The
+// tradeoff is precision: boundaries that round to the same float32 leave
+// the bins between them unreachable, and boundaries outside the float32
+// range round to ±Inf.
+func (bin *Bin) SearchFloat32(value float32) int {
+	if bin.uniformBinWidth <= 0 {
+		if bin.empty {
+			return 0
+		}
+		panic(ErrUnprepared.Error())
+	}
+
+	n := bin.search(float64(value))
+
+	// Rounding to float32 is monotonic, so only boundaries next to n can be
+	// on the other side of value after rounding.
+	for n > 0 && value < float32(bin.boundaries[n-1]) {
+		n--
+	}
+	for n < len(bin.boundaries) && value >= float32(bin.boundaries[n]) {
+		n++
+	}
+
+	if bin.opts != (Options{}) {
+		n = bin.applyOptions(n, float64(value))
+	}
+	return n
+}
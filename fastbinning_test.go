@@ -15,7 +15,16 @@ limitations under the License.
 */
 package fastbinning
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"testing/quick"
+)
 
 func cmpIntSlice(a []int, b []int) bool {
 	if len(a) != len(b) {
@@ -72,3 +81,1243 @@ func TestBinningExample(t *testing.T) {
 		}
 	}
 }
+
+func TestUniformBinWidth(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+	if bin.UniformBinWidth() != 4 {
+		t.Errorf("Expected UniformBinWidth() to be 4 but got %f\n", bin.UniformBinWidth())
+	}
+
+	bin, _ = NewWithBinWidth([]float64{2, 11, 19, 20, 21, 27, 29, 30}, 1.5)
+	if bin.UniformBinWidth() != 1.5 {
+		t.Errorf("Expected UniformBinWidth() to be the requested 1.5 but got %f\n", bin.UniformBinWidth())
+	}
+}
+
+func TestBoundaryHistogram(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	expected := []int{0, 0, 1, 0, 3, 0, 2}
+	h := bin.BoundaryHistogram()
+	if !cmpIntSlice(h, expected) {
+		t.Errorf("Expected BoundaryHistogram()\n%v but got\n%v\n", expected, h)
+	}
+
+	// Modifying the copy must neither change the Bin nor later copies
+	for i := range h {
+		h[i] = 99
+	}
+	if !cmpIntSlice(bin.histogram, expected) || !cmpIntSlice(bin.BoundaryHistogram(), expected) {
+		t.Errorf("Expected BoundaryHistogram() to return an independent copy")
+	}
+	if out := bin.Search(19.9); out != 3 {
+		t.Errorf("Expected 19.9 to still be binned to 3 but got %d", out)
+	}
+}
+
+func TestCumulativeBoundaryHistogram(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	expected := []int{1, 1, 1, 2, 2, 5, 5, 7}
+	h := bin.CumulativeBoundaryHistogram()
+	if !cmpIntSlice(h, expected) {
+		t.Errorf("Expected CumulativeBoundaryHistogram()\n%v but got\n%v\n", expected, h)
+	}
+
+	// Modifying the copy must neither change the Bin nor later copies
+	for i := range h {
+		h[i] = 99
+	}
+	if !cmpIntSlice(bin.cumulativeHistogram, expected) || !cmpIntSlice(bin.CumulativeBoundaryHistogram(), expected) {
+		t.Errorf("Expected CumulativeBoundaryHistogram() to return an independent copy")
+	}
+	if out := bin.Search(19.9); out != 3 {
+		t.Errorf("Expected 19.9 to still be binned to 3 but got %d", out)
+	}
+}
+
+// TestPaperExample checks the intermediate arrays and searches of the example
+// by Cadenas and Megson, which is also the example of the README, against
+// values worked out by hand from the paper's definitions.
+func TestPaperExample(t *testing.T) {
+	bin, err := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// m = 7 bins over [2, 30) give uniform bins of width (30-2)/7 = 4:
+	// [2,6) [6,10) [10,14) [14,18) [18,22) [22,26) [26,30)
+	if bin.UniformBinWidth() != 4 {
+		t.Errorf("Expected a uniform bin width of 4 but got %f", bin.UniformBinWidth())
+	}
+
+	// The interior boundaries 11 | 19 20 21 | 27 29 fall into the uniform
+	// bins 3, 5 and 7
+	if h, exp := bin.BoundaryHistogram(), []int{0, 0, 1, 0, 3, 0, 2}; !cmpIntSlice(h, exp) {
+		t.Errorf("Expected histogram %v but got %v", exp, h)
+	}
+	// c[k] = 1 + h[0] + ... + h[k-1]
+	if c, exp := bin.CumulativeBoundaryHistogram(), []int{1, 1, 1, 2, 2, 5, 5, 7}; !cmpIntSlice(c, exp) {
+		t.Errorf("Expected cumulative histogram %v but got %v", exp, c)
+	}
+
+	// One query per case of the search, with its uniform bin k, h = h[k-1]
+	// and r = c[k-1]
+	testData := []struct {
+		value float64
+		bin   int
+	}{
+		{1, 0},    // left of b[0]
+		{2, 1},    // k = 1, h = 0: bin r = 1
+		{7, 1},    // k = 2, h = 0: bin r = 1
+		{10.5, 1}, // k = 3, h = 1, r = 1: 10.5 < b[1] = 11, bin r = 1
+		{11, 2},   // k = 3, h = 1, r = 1: 11 >= b[1], bin r+1 = 2
+		{15, 2},   // k = 4, h = 0: bin r = 2
+		{18.5, 2}, // k = 5, h = 3, r = 2: 18.5 < b[2] = 19, bin 2
+		{19.5, 3}, // k = 5, h = 3, r = 2: b[2] <= 19.5 < b[3] = 20, bin 3
+		{20, 4},   // k = 5, h = 3, r = 2: b[3] <= 20 < b[4] = 21, bin 4
+		{21.9, 5}, // k = 5, h = 3, r = 2: 21.9 >= b[4] = 21, bin 5
+		{25, 5},   // k = 6, h = 0: bin r = 5
+		{26.5, 5}, // k = 7, h = 2, r = 5: 26.5 < b[5] = 27, bin r = 5
+		{28, 6},   // k = 7, h = 2, r = 5: b[5] <= 28 < b[6] = 29, bin r+1 = 6
+		{29.5, 7}, // k = 7, h = 2, r = 5: 29.5 >= b[6] = 29, bin r+2 = 7
+		{30, 8},   // at or right of b[7]
+	}
+	for _, d := range testData {
+		if out := bin.Search(d.value); out != d.bin {
+			t.Errorf("Expected %f to be binned to %d but got %d", d.value, d.bin, out)
+		}
+	}
+}
+
+// linearSearch is the trivial reference implementation of Search: the bin
+// number is the number of boundaries that are <= value.
+func linearSearch(boundaries []float64, value float64) int {
+	n := 0
+	for _, b := range boundaries {
+		if b <= value {
+			n++
+		}
+	}
+	return n
+}
+
+// randomBoundaries generates n strictly increasing boundaries. Gaps vary over
+// several orders of magnitude so that uniform bins with 0, 1, 2 and many
+// boundaries all occur.
+func randomBoundaries(rng *rand.Rand, n int) []float64 {
+	boundaries := make([]float64, n)
+	boundaries[0] = rng.NormFloat64() * 100
+	for i := 1; i < n; i++ {
+		gap := rng.ExpFloat64() * math.Pow(10, float64(rng.Intn(7)-3))
+		b := boundaries[i-1] + gap
+		if b <= boundaries[i-1] {
+			b = math.Nextafter(boundaries[i-1], math.Inf(1))
+		}
+		boundaries[i] = b
+	}
+	return boundaries
+}
+
+func FuzzSearch(f *testing.F) {
+	f.Add(int64(0), uint8(0), 0.0)
+	f.Add(int64(1), uint8(1), 13.2)
+	f.Add(int64(2), uint8(7), -4.0)
+	f.Add(int64(3), uint8(64), 1e6)
+	f.Add(int64(4), uint8(255), 0.5)
+
+	f.Fuzz(func(t *testing.T, seed int64, n uint8, value float64) {
+		if math.IsNaN(value) {
+			t.Skip()
+		}
+
+		rng := rand.New(rand.NewSource(seed))
+		boundaries := randomBoundaries(rng, int(n)+2)
+		bin, err := New(boundaries)
+		if err != nil {
+			t.Fatalf("New(%v) failed: %s", boundaries, err)
+		}
+
+		// Query the fuzzed value, every boundary, its direct neighbours and
+		// random values in and around the range.
+		lo, hi := boundaries[0], boundaries[len(boundaries)-1]
+		values := []float64{value}
+		for _, b := range boundaries {
+			values = append(values, b, math.Nextafter(b, math.Inf(-1)), math.Nextafter(b, math.Inf(1)))
+		}
+		for i := 0; i < 100; i++ {
+			values = append(values, lo+(rng.Float64()*1.2-0.1)*(hi-lo))
+		}
+
+		for _, v := range values {
+			exp := linearSearch(boundaries, v)
+			if out := bin.Search(v); out != exp {
+				t.Fatalf("Expected %g to be binned to %d but got %d; boundaries %v", v, exp, out, boundaries)
+			}
+			if out := bin.LinearSearch(v); out != exp {
+				t.Fatalf("Expected LinearSearch to bin %g to %d but got %d; boundaries %v", v, exp, out, boundaries)
+			}
+		}
+	})
+}
+
+func TestSearchClassified(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	testData := map[float64]BinKind{
+		-4:   Underflow,
+		1.9:  Underflow,
+		2:    Proper,
+		20.5: Proper,
+		29.9: Proper,
+		30:   Overflow,
+		99:   Overflow,
+	}
+
+	for data, exp := range testData {
+		n, kind := bin.SearchClassified(data)
+		if kind != exp {
+			t.Errorf("Expected %f to be classified %s but got %s\n", data, exp, kind)
+		}
+		if n != bin.Search(data) {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, bin.Search(data), n)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	boundaries := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+	bin, _ := New(boundaries)
+
+	for _, b := range []float64{25, 0, 40} {
+		if err := bin.Insert(b); err != nil {
+			t.Fatalf("Unexpected error inserting %f: %s", b, err)
+		}
+	}
+
+	expected := []float64{0, 2, 11, 19, 20, 21, 25, 27, 29, 30, 40}
+	if !cmpFloatSlice(bin.boundaries, expected) {
+		t.Errorf("Expected boundaries\n%v but got\n%v\n", expected, bin.boundaries)
+	}
+	if boundaries[5] != 27 {
+		t.Errorf("Insert modified the slice passed to New: %v", boundaries)
+	}
+
+	for _, v := range []float64{-1, 0, 1, 24, 25, 26, 30, 39, 40, 41} {
+		if out, exp := bin.Search(v), linearSearch(expected, v); out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", v, exp, out)
+		}
+	}
+
+	if err := bin.Insert(20); err == nil {
+		t.Errorf("Expected error when inserting an existing boundary")
+	}
+}
+
+func TestSearchFloat32(t *testing.T) {
+	bin, _ := New([]float64{0, 0.7, 1})
+
+	// float32(0.7) is slightly below 0.7, so it lies below the float64
+	// boundary but on the float32 boundary.
+	v := float32(0.7)
+	if out := bin.Search(float64(v)); out != 1 {
+		t.Errorf("Expected Search to bin %f to 1 but got %d\n", v, out)
+	}
+	if out := bin.SearchFloat32(v); out != 2 {
+		t.Errorf("Expected SearchFloat32 to bin %f to 2 but got %d\n", v, out)
+	}
+
+	for _, v := range []float32{-1, 0, 0.5, 0.69, 0.71, 1, 2} {
+		if out, exp := bin.SearchFloat32(v), bin.Search(float64(v)); out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", v, exp, out)
+		}
+	}
+}
+
+func TestSearchFloat32Options(t *testing.T) {
+	boundaries := []float64{2, 11, 19, 20}
+	for _, opts := range []Options{
+		{OpenEnded: true},
+		{ClosedUpper: true},
+		{Clamp: true},
+		{Epsilon: 0.5},
+	} {
+		bin, err := NewWithOptions(boundaries, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		// All values and boundaries are exact in float32
+		for _, v := range []float32{-4, 1.75, 2, 10.5, 11, 19.5, 20, 99} {
+			if out, exp := bin.SearchFloat32(v), bin.Search(float64(v)); out != exp {
+				t.Errorf("Expected SearchFloat32 to bin %f to %d with %+v but got %d", v, exp, opts, out)
+			}
+		}
+	}
+}
+
+func TestSingleBin(t *testing.T) {
+	bin, err := New([]float64{-1, 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !cmpIntSlice(bin.histogram, []int{0}) {
+		t.Errorf("Expected histogram [0] but got %v\n", bin.histogram)
+	}
+	if !cmpIntSlice(bin.cumulativeHistogram, []int{1, 1}) {
+		t.Errorf("Expected cumulativeHistogram [1 1] but got %v\n", bin.cumulativeHistogram)
+	}
+
+	testData := map[float64]int{
+		-2:   0,
+		-1.1: 0,
+		-1:   1,
+		0:    1,
+		0.99: 1,
+		1:    2,
+		5:    2,
+	}
+
+	for data, exp := range testData {
+		out := bin.Search(data)
+		if out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, exp, out)
+		}
+	}
+}
+
+func TestSearchOr(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	testData := map[float64]int{
+		-4:   -1,
+		2:    1,
+		20.5: 4,
+		29.9: 7,
+		30:   -2,
+	}
+
+	for data, exp := range testData {
+		out := bin.SearchOr(data, -1, -2)
+		if out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, exp, out)
+		}
+	}
+}
+
+func TestBins(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	expected := []Interval{{2, 11}, {11, 19}, {19, 20}}
+	var intervals []Interval
+	for n, interval := range bin.Bins {
+		if n != len(intervals)+1 {
+			t.Errorf("Expected bin number %d but got %d", len(intervals)+1, n)
+		}
+		intervals = append(intervals, interval)
+	}
+	if len(intervals) != len(expected) {
+		t.Fatalf("Expected intervals\n%v but got\n%v\n", expected, intervals)
+	}
+	for i, interval := range intervals {
+		if interval != expected[i] {
+			t.Errorf("Expected intervals\n%v but got\n%v\n", expected, intervals)
+		}
+	}
+
+	for n := range bin.Bins {
+		if n == 2 {
+			break
+		}
+	}
+}
+
+func TestNewCopiesBoundaries(t *testing.T) {
+	boundaries := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+	bin, _ := New(boundaries)
+
+	// Reuse the slice as scratch space
+	for i := range boundaries {
+		boundaries[i] = float64(100 * i)
+	}
+
+	testData := map[float64]int{
+		0:    0,
+		10.5: 1,
+		20:   4,
+		29.9: 7,
+		30:   8,
+	}
+
+	for data, exp := range testData {
+		out := bin.Search(data)
+		if out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, exp, out)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	expected := "Bin{bins: 7, range: [2, 30), uniformBinWidth: 4, maxUniformBinCount: 3, boundaries: [2 11 19 20 21 27 29 30]}"
+	if out := fmt.Sprintf("%v", bin); out != expected {
+		t.Errorf("Expected\n%s but got\n%s\n", expected, out)
+	}
+
+	bin, _ = New(uniformBoundaries(0, 100, 100))
+	expected = "Bin{bins: 100, range: [0, 100), uniformBinWidth: 1, maxUniformBinCount: 1}"
+	if out := bin.String(); out != expected {
+		t.Errorf("Expected\n%s but got\n%s\n", expected, out)
+	}
+
+	if out := (&Bin{}).String(); out != "Bin{unprepared}" {
+		t.Errorf("Expected unprepared Bin to print as Bin{unprepared} but got %s", out)
+	}
+}
+
+func TestProperBinIndex(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	testData := map[float64]int{
+		1:    -1,
+		2:    0,
+		18:   1,
+		19.5: 2,
+		20:   -1,
+	}
+
+	for data, exp := range testData {
+		idx, ok := bin.ProperBinIndex(data)
+		if ok != (exp >= 0) || (ok && idx != exp) {
+			t.Errorf("Expected %f to have proper bin index %d but got %d (ok: %t)\n", data, exp, idx, ok)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	if !bin.Covers([]float64{2, 5, 19.99}) {
+		t.Errorf("Expected values within [2, 20) to be covered")
+	}
+	if bin.Covers([]float64{2, 5, 20}) {
+		t.Errorf("Expected 20 not to be covered")
+	}
+	if bin.Covers([]float64{math.NaN()}) {
+		t.Errorf("Expected NaN not to be covered")
+	}
+
+	if out := bin.CoverageFraction([]float64{1, 2, 5, 20}); out != 0.5 {
+		t.Errorf("Expected coverage fraction 0.5 but got %f", out)
+	}
+	if out := bin.CoverageFraction(nil); out != 1 {
+		t.Errorf("Expected empty values to be fully covered but got %f", out)
+	}
+}
+
+// TestExactBoundaryHits bins values exactly on a boundary, and just below
+// it, through each branch of Search. A flipped comparison in any branch
+// would bin them to the wrong side.
+func TestExactBoundaryHits(t *testing.T) {
+	//                    0   1   2   3   4   5   6   7
+	boundaries := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+	bin, _ := New(boundaries)
+
+	// Values on uniform bin edges holding no boundary, then the boundaries
+	// of uniform bins holding one, two and three boundaries
+	testData := map[int][]float64{
+		0: {6, 14, 22},
+		1: {11},
+		2: {27, 29},
+		3: {19, 20, 21},
+	}
+	for h, values := range testData {
+		for _, v := range values {
+			if got := bin.histogram[bin.uniformBinNumber(v)-1]; got != h {
+				t.Fatalf("Expected %f to take the h = %d branch but it takes h = %d", v, h, got)
+			}
+
+			below := math.Nextafter(v, math.Inf(-1))
+			for _, x := range []float64{v, below} {
+				if exp, out := linearSearch(boundaries, x), bin.Search(x); out != exp {
+					t.Errorf("Expected %v to be binned to %d in the h = %d branch but got %d", x, exp, h, out)
+				}
+			}
+		}
+	}
+
+	// Boundary hits in the uniform path
+	uniform, _ := New([]float64{0, 1, 2, 3, 4})
+	for i, b := range uniform.boundaries {
+		if out := uniform.Search(b); out != i+1 {
+			t.Errorf("Expected %f to be binned to %d in a uniform Bin but got %d", b, i+1, out)
+		}
+	}
+}
+
+func TestOpenEnded(t *testing.T) {
+	bin, err := NewWithOptions([]float64{2, 11, 19, 20}, Options{OpenEnded: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	testData := map[float64]int{
+		-4:   1,
+		2:    1,
+		11:   2,
+		19.5: 3,
+		20:   3,
+		99:   3,
+	}
+
+	for data, exp := range testData {
+		if out := bin.Search(data); out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, exp, out)
+		}
+		if out := bin.LinearSearch(data); out != exp {
+			t.Errorf("Expected LinearSearch to bin %f to %d but got %d\n", data, exp, out)
+		}
+		if out := bin.SearchFloat32(float32(data)); out != exp {
+			t.Errorf("Expected SearchFloat32 to bin %f to %d but got %d\n", data, exp, out)
+		}
+	}
+}
+
+func TestClosedUpper(t *testing.T) {
+	boundaries := []float64{2, 11, 19, 20}
+	open, _ := New(boundaries)
+	closed, err := NewWithOptions(boundaries, Options{ClosedUpper: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Only the last boundary itself is binned differently
+	testData := map[float64][2]int{
+		1:     {0, 0},
+		2:     {1, 1},
+		19:    {3, 3},
+		19.99: {3, 3},
+		20:    {4, 3},
+		20.01: {4, 4},
+	}
+	for data, exp := range testData {
+		if out := open.Search(data); out != exp[0] {
+			t.Errorf("Expected %f to be binned to %d by default but got %d", data, exp[0], out)
+		}
+		if out := closed.Search(data); out != exp[1] {
+			t.Errorf("Expected %f to be binned to %d with ClosedUpper but got %d", data, exp[1], out)
+		}
+		if out := closed.LinearSearch(data); out != exp[1] {
+			t.Errorf("Expected LinearSearch to bin %f to %d with ClosedUpper but got %d", data, exp[1], out)
+		}
+		if out := closed.SearchFloat32(float32(data)); out != exp[1] {
+			t.Errorf("Expected SearchFloat32 to bin %f to %d with ClosedUpper but got %d", data, exp[1], out)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	bin, err := NewWithOptions([]float64{2, 11, 19, 20}, Options{Clamp: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	testData := map[float64]int{
+		-4:   1,
+		2:    1,
+		19.5: 3,
+		20:   3,
+		99:   3,
+	}
+	for data, exp := range testData {
+		if out := bin.Search(data); out != exp {
+			t.Errorf("Expected %f to be binned to %d but got %d\n", data, exp, out)
+		}
+	}
+	if out := bin.ClampedCount(); out != 3 {
+		t.Errorf("Expected 3 clamped values but got %d", out)
+	}
+
+	for data, exp := range testData {
+		if out := bin.SearchFloat32(float32(data)); out != exp {
+			t.Errorf("Expected SearchFloat32 to bin %f to %d but got %d\n", data, exp, out)
+		}
+	}
+	if out := bin.ClampedCount(); out != 6 {
+		t.Errorf("Expected SearchFloat32 to count 3 more clamped values but got %d in total", out)
+	}
+
+	if bin.LinearSearch(-4) != 1 || bin.ClampedCount() != 6 {
+		t.Errorf("Expected LinearSearch to clamp -4 to 1 without counting it but got %d clamped values", bin.ClampedCount())
+	}
+
+	plain, _ := New([]float64{2, 11, 19, 20})
+	plain.Search(-4)
+	if out := plain.ClampedCount(); out != 0 {
+		t.Errorf("Expected no clamped values without Clamp but got %d", out)
+	}
+}
+
+func TestExtremeRanges(t *testing.T) {
+	// The range overflows to infinity
+	if _, err := New([]float64{-math.MaxFloat64, math.MaxFloat64}); err == nil {
+		t.Errorf("Expected an error for a range wider than float64 can hold")
+	}
+	bin, _ := New([]float64{0, math.MaxFloat64})
+	if err := bin.Insert(-math.MaxFloat64); err == nil {
+		t.Errorf("Expected an error when inserting widens the range beyond float64")
+	}
+	if bin.Boundary(0) != 0 || bin.Search(1) != 1 {
+		t.Errorf("Expected a failed Insert to leave the Bin unchanged")
+	}
+
+	// Denormal ranges are tiny but still divide into uniform bins
+	tiny := []float64{0, 5e-324, 1e-323, 2e-323}
+	bin, err := New(tiny)
+	if err != nil {
+		t.Fatalf("Unexpected error for denormal boundaries: %s", err)
+	}
+	for _, v := range append(tiny, -5e-324, 1.5e-323, 1) {
+		if exp, out := linearSearch(tiny, v), bin.Search(v); out != exp {
+			t.Errorf("Expected %g to be binned to %d but got %d", v, exp, out)
+		}
+	}
+
+	if _, err := NewWithBinWidth([]float64{0, 1}, 5e-324); err == nil {
+		t.Errorf("Expected an error for a uniform bin width creating too many uniform bins")
+	}
+}
+
+func TestNonFiniteBoundaries(t *testing.T) {
+	for _, nonFinite := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		for _, i := range []int{0, 2, 4} {
+			boundaries := []float64{1, 2, 3, 4, 5}
+			boundaries[i] = nonFinite
+
+			if _, err := New(boundaries); err == nil {
+				t.Errorf("Expected error for %f at index %d", nonFinite, i)
+			}
+		}
+
+		bin, _ := New([]float64{1, 2, 3})
+		if err := bin.Insert(nonFinite); err == nil {
+			t.Errorf("Expected error when inserting %f", nonFinite)
+		}
+	}
+}
+
+func TestUnsortedBoundariesError(t *testing.T) {
+	testData := map[string][]float64{
+		"boundaries must be monotonically sorted. Found 5.000000 >= 3.000000 at index 0 and 1": {5, 3, 7},
+		"boundaries must be monotonically sorted. Found 7.000000 >= 7.000000 at index 2 and 3": {1, 3, 7, 7},
+	}
+	for exp, boundaries := range testData {
+		_, err := New(boundaries)
+		if err == nil || err.Error() != exp {
+			t.Errorf("Expected error %q for %v but got %v", exp, boundaries, err)
+		}
+	}
+}
+
+func TestSearchPacked(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	testData := map[float64]float64{
+		-4:    0,
+		2:     1,
+		6.5:   1.5,
+		13:    2.25,
+		19.75: 3.75,
+		20:    4,
+		99:    4,
+	}
+
+	for data, exp := range testData {
+		if out := bin.SearchPacked(data); out != exp {
+			t.Errorf("Expected %f to be packed to %f but got %f\n", data, exp, out)
+		}
+	}
+
+	packed := bin.SearchPackedAll([]float64{6.5, 13, math.Nextafter(19, 0)})
+	if packed[0] != 1.5 || packed[1] != 2.25 {
+		t.Errorf("Expected packed values [1.5 2.25 ...] but got %v", packed)
+	}
+	if packed[2] >= 3 || packed[2] < 2 {
+		t.Errorf("Expected a value just below 19 to stay in bin 2 but got %f", packed[2])
+	}
+
+	// A fraction close to 1 must not round up to the next bin in float64
+	boundaries := make([]float64, 1002)
+	for i := range boundaries {
+		boundaries[i] = float64(i - 1000)
+	}
+	bin, _ = New(boundaries)
+	v := math.Nextafter(1, 0)
+	if n, out := bin.Search(v), bin.SearchPacked(v); n != 1001 || math.Floor(out) != 1001 {
+		t.Errorf("Expected %v to be packed into bin %d but got %f", v, n, out)
+	}
+}
+
+func TestBoundaries(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	boundaries := bin.Boundaries()
+	if !cmpFloatSlice(boundaries, []float64{2, 11, 19, 20}) {
+		t.Errorf("Expected boundaries [2 11 19 20] but got %v", boundaries)
+	}
+
+	boundaries[1] = 15
+	if bin.Boundary(1) != 11 {
+		t.Errorf("Modifying the returned boundaries changed the Bin")
+	}
+
+	view := bin.BoundariesView()
+	if !cmpFloatSlice(view, []float64{2, 11, 19, 20}) {
+		t.Errorf("Expected the view [2 11 19 20] but got %v", view)
+	}
+	if &view[0] != &bin.boundaries[0] {
+		t.Errorf("Expected the view to share the boundaries of the Bin")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { bin.BoundariesView() }); allocs != 0 {
+		t.Errorf("Expected BoundariesView not to allocate but got %f allocations", allocs)
+	}
+}
+
+func TestUniformBoundaries(t *testing.T) {
+	for _, boundaries := range [][]float64{
+		{0, 1, 2, 3, 4},
+		{0, 0.1, 0.2, 0.30000000000000004, 0.4},
+		uniformBoundaries(-1, 1, 1000),
+		uniformBoundaries(0.1, 0.7, 37),
+	} {
+		bin, _ := New(boundaries)
+		if !bin.uniform {
+			t.Errorf("Expected %v to be detected as uniform", boundaries)
+		}
+
+		for _, b := range boundaries {
+			for _, v := range []float64{b, math.Nextafter(b, math.Inf(-1)), math.Nextafter(b, math.Inf(1))} {
+				if out, exp := bin.Search(v), linearSearch(boundaries, v); out != exp {
+					t.Errorf("Expected %g to be binned to %d but got %d\n", v, exp, out)
+				}
+			}
+		}
+	}
+
+	bin, _ := New([]float64{0, 1, 2, 3.5, 4})
+	if bin.uniform {
+		t.Errorf("Expected non-uniform boundaries not to be detected as uniform")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+	same, _ := New([]float64{2, 11, 19, 20})
+	shorter, _ := New([]float64{2, 11, 19})
+	different, _ := New([]float64{2, 11, 18, 20})
+	openEnded, _ := NewWithOptions([]float64{2, 11, 19, 20}, Options{OpenEnded: true})
+
+	if !bin.Equal(same) {
+		t.Errorf("Expected Bins with the same boundaries to be equal")
+	}
+	withStats, _ := NewWithOptions([]float64{2, 11, 19, 20}, Options{CollectBranchStats: true})
+	if !bin.Equal(withStats) || bin.Hash() != withStats.Hash() {
+		t.Errorf("Expected collecting branch statistics not to affect Equal and Hash")
+	}
+	for _, other := range []*Bin{shorter, different, openEnded, nil} {
+		if bin.Equal(other) {
+			t.Errorf("Expected %v not to equal %v", bin, other)
+		}
+	}
+}
+
+func TestNarrowestBin(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+	if index, width, risky := bin.NarrowestBin(); index != 3 || width != 1 || risky {
+		t.Errorf("Expected narrowest bin 3 of width 1 without risk but got %d of width %f (risky: %t)", index, width, risky)
+	}
+
+	bin, _ = New([]float64{0, 1, 1 + 1e-9, 2})
+	if index, _, risky := bin.NarrowestBin(); index != 2 || !risky {
+		t.Errorf("Expected risky narrowest bin 2 but got %d (risky: %t)", index, risky)
+	}
+}
+
+func TestHash(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	// The hash must not change between runs or releases
+	if h := bin.Hash(); h != 0x51d4f832d42b93c {
+		t.Errorf("Expected hash 0x51d4f832d42b93c but got %#x", h)
+	}
+
+	other, _ := New([]float64{2, 11, 18, 20})
+	if bin.Hash() == other.Hash() {
+		t.Errorf("Expected different boundaries to hash differently")
+	}
+
+	zero, _ := New([]float64{-1, 0, 1})
+	negativeZero, _ := New([]float64{-1, math.Copysign(0, -1), 1})
+	if zero.Hash() != negativeZero.Hash() {
+		t.Errorf("Expected equal Bins with 0 and -0 to have the same hash")
+	}
+}
+
+func benchmarkSearch(b *testing.B, boundaryCount int, fast bool) {
+	bin, values := benchmarkDataWithBoundaries(boundaryCount, 1<<16)
+	if fast {
+		bin, _ = NewFast(bin.boundaries)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bin.Search(values[i&(1<<16-1)])
+	}
+}
+
+func BenchmarkSearch1K(b *testing.B)     { benchmarkSearch(b, 1000, false) }
+func BenchmarkSearchFast1K(b *testing.B) { benchmarkSearch(b, 1000, true) }
+func BenchmarkSearch1M(b *testing.B)     { benchmarkSearch(b, 1000000, false) }
+func BenchmarkSearchFast1M(b *testing.B) { benchmarkSearch(b, 1000000, true) }
+
+func TestSearchFraction(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	testData := map[float64][2]float64{
+		-4:    {0, 0},
+		2:     {1, 0},
+		6.5:   {1, 0.5},
+		13:    {2, 0.25},
+		19.75: {3, 0.75},
+		20:    {4, 1},
+	}
+
+	for data, exp := range testData {
+		n, frac := bin.SearchFraction(data)
+		if n != int(exp[0]) || frac != exp[1] {
+			t.Errorf("Expected %f to be in bin %d at %f but got %d at %f\n", data, int(exp[0]), exp[1], n, frac)
+		}
+	}
+}
+
+func TestSearchE(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	if n, err := bin.SearchE(13); err != nil || n != 2 {
+		t.Errorf("Expected 13 to be binned to 2 but got %d (error: %v)", n, err)
+	}
+	if _, err := bin.SearchE(math.NaN()); err != ErrNaN {
+		t.Errorf("Expected ErrNaN but got %v", err)
+	}
+	if _, err := (&Bin{}).SearchE(13); err != ErrUnprepared {
+		t.Errorf("Expected ErrUnprepared but got %v", err)
+	}
+}
+
+func TestSearchNaN(t *testing.T) {
+	nan := math.NaN()
+	for _, boundaries := range [][]float64{
+		{2, 11, 19, 20},
+		{0, 1, 2, 3}, // uniform
+		{2, 11, 19, 20, 21, 27, 29, 30},
+	} {
+		bin, _ := New(boundaries)
+		overflow := len(boundaries)
+		searches := map[string]int{
+			"Search":        bin.Search(nan),
+			"SearchFloat32": bin.SearchFloat32(float32(nan)),
+			"SearchApprox":  bin.SearchApprox(nan),
+			"SearchHint":    bin.SearchHint(nan, 1),
+			"LinearSearch":  bin.LinearSearch(nan),
+			"SearchSorted":  bin.SearchSorted([]float64{nan})[0],
+		}
+		for name, out := range searches {
+			if out != overflow {
+				t.Errorf("Expected %s to bin NaN to the overflow %d but got %d", name, overflow, out)
+			}
+		}
+	}
+
+	bin, _ := New([]float64{2, 11, 19, 20})
+	if counts, _ := bin.CountRange([]float64{nan, 3}, 0, 30); !cmpIntSlice(counts, []int{0, 1, 0, 0, 0}) {
+		t.Errorf("Expected CountRange to skip NaN but got %v", counts)
+	}
+}
+
+// TestSearchMonotonic checks the fundamental contract of binning: for any
+// a <= b, Search(a) <= Search(b)
+func TestSearchMonotonic(t *testing.T) {
+	property := func(seed int64, n uint8, fa, fb uint16) bool {
+		rng := rand.New(rand.NewSource(seed))
+		boundaries := randomBoundaries(rng, int(n)+2)
+		bin, err := New(boundaries)
+		if err != nil {
+			t.Fatalf("New(%v) failed: %s", boundaries, err)
+		}
+
+		// Spread the values over the range and a bit beyond it
+		lo, hi := boundaries[0], boundaries[len(boundaries)-1]
+		a := lo + (float64(fa)/math.MaxUint16*1.2-0.1)*(hi-lo)
+		b := lo + (float64(fb)/math.MaxUint16*1.2-0.1)*(hi-lo)
+		if a > b {
+			a, b = b, a
+		}
+
+		// Neighbouring floats are the most likely to break the order
+		for _, pair := range [][2]float64{{a, b}, {a, math.Nextafter(a, math.Inf(1))}} {
+			if bin.Search(pair[0]) > bin.Search(pair[1]) {
+				t.Errorf("Expected Search(%g) = %d <= Search(%g) = %d; boundaries %v",
+					pair[0], bin.Search(pair[0]), pair[1], bin.Search(pair[1]), boundaries)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// FuzzSearchTopEdge hammers the values just below the last boundary, where
+// rounding in the uniform bin number is most likely to overshoot
+func FuzzSearchTopEdge(f *testing.F) {
+	f.Add(int64(0), uint8(0), 1.0)
+	f.Add(int64(1), uint8(3), 1e-300)
+	f.Add(int64(2), uint8(100), 1e300)
+	f.Add(int64(3), uint8(255), 0.1)
+
+	f.Fuzz(func(t *testing.T, seed int64, n uint8, scale float64) {
+		if !(scale > 0) || math.IsInf(scale, 0) {
+			t.Skip()
+		}
+
+		rng := rand.New(rand.NewSource(seed))
+		boundaries := randomBoundaries(rng, int(n)+2)
+		for i := range boundaries {
+			boundaries[i] *= scale
+		}
+		if validateBoundaries(boundaries) != nil || math.IsInf(boundaries[len(boundaries)-1]-boundaries[0], 0) {
+			t.Skip()
+		}
+		bin, err := New(boundaries)
+		if err != nil {
+			t.Fatalf("New(%v) failed: %s", boundaries, err)
+		}
+
+		v := boundaries[len(boundaries)-1]
+		for i := 0; i < 64; i++ {
+			v = math.Nextafter(v, math.Inf(-1))
+			exp := linearSearch(boundaries, v)
+			if out := bin.Search(v); out != exp {
+				t.Fatalf("Expected %g to be binned to %d but got %d; boundaries %v", v, exp, out, boundaries)
+			}
+		}
+	})
+}
+
+func TestEpsilon(t *testing.T) {
+	// Constant expressions are exact in Go, so add at run time
+	a, b := 0.1, 0.2
+	boundaries := []float64{0, a + b, 1}
+	exact, _ := New(boundaries)
+	bin, err := NewWithOptions(boundaries, Options{Epsilon: 1e-9})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// 0.3 lies just below 0.1+0.2, so it only reaches the second bin with
+	// a tolerance
+	if out := exact.Search(0.3); out != 1 {
+		t.Errorf("Expected 0.3 to be binned to 1 without epsilon but got %d", out)
+	}
+
+	testData := map[float64]int{
+		-1e-10:    1,
+		0:         1,
+		0.2:       1,
+		0.3:       2,
+		0.5:       2,
+		1 - 1e-10: 3,
+		1:         3,
+	}
+	for data, exp := range testData {
+		if out := bin.Search(data); out != exp {
+			t.Errorf("Expected %v to be binned to %d but got %d", data, exp, out)
+		}
+		if out := bin.LinearSearch(data); out != exp {
+			t.Errorf("Expected LinearSearch to bin %v to %d but got %d", data, exp, out)
+		}
+	}
+
+	for _, eps := range []float64{-1, math.NaN(), math.Inf(1)} {
+		if _, err := NewWithOptions(boundaries, Options{Epsilon: eps}); err == nil {
+			t.Errorf("Expected an error for epsilon %v", eps)
+		}
+	}
+}
+
+func TestSearchR(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+	inf := math.Inf(1)
+
+	testData := []struct {
+		value    float64
+		number   int
+		under    bool
+		over     bool
+		index    int
+		ok       bool
+		interval Interval
+	}{
+		{-4, 0, true, false, 0, false, Interval{-inf, 2}},
+		{2, 1, false, false, 0, true, Interval{2, 11}},
+		{19.5, 3, false, false, 2, true, Interval{19, 20}},
+		{20, 4, false, true, 0, false, Interval{20, inf}},
+	}
+	for _, d := range testData {
+		r := bin.SearchR(d.value)
+		if r.Number() != d.number {
+			t.Errorf("Expected %f to be binned to %d but got %d", d.value, d.number, r.Number())
+		}
+		if r.IsUnderflow() != d.under || r.IsOverflow() != d.over {
+			t.Errorf("Expected underflow %t and overflow %t for %f", d.under, d.over, d.value)
+		}
+		if idx, ok := r.ProperIndex(); idx != d.index || ok != d.ok {
+			t.Errorf("Expected proper index %d, %t for %f but got %d, %t", d.index, d.ok, d.value, idx, ok)
+		}
+		if r.Interval() != d.interval {
+			t.Errorf("Expected interval %v for %f but got %v", d.interval, d.value, r.Interval())
+		}
+	}
+}
+
+func TestSearchLabel(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	if out := bin.SearchLabel(5); out != "" {
+		t.Errorf("Expected no label before SetLabels but got %q", out)
+	}
+
+	if err := bin.SetLabels([]string{"low", "medium", "high"}); err == nil {
+		t.Errorf("Expected an error for too few labels")
+	}
+	if err := bin.SetLabels([]string{"below", "low", "medium", "high", "above"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	testData := map[float64]string{
+		-1: "below",
+		0:  "low",
+		15: "medium",
+		29: "high",
+		30: "above",
+	}
+	for data, exp := range testData {
+		if out := bin.SearchLabel(data); out != exp {
+			t.Errorf("Expected %f to be labeled %q but got %q", data, exp, out)
+		}
+	}
+
+	if err := bin.Insert(5); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out := bin.SearchLabel(15); out != "" {
+		t.Errorf("Expected Insert to remove the labels but got %q", out)
+	}
+}
+
+func TestNearestBoundary(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	testData := map[float64]int{
+		-4:   0,
+		2:    0,
+		6.5:  0, // tie goes to the lower boundary
+		6.6:  1,
+		15.5: 2,
+		19.6: 3,
+		99:   3,
+	}
+	for data, exp := range testData {
+		idx, boundary := bin.NearestBoundary(data)
+		if idx != exp || boundary != bin.Boundary(exp) {
+			t.Errorf("Expected nearest boundary of %f at %d but got %f at %d", data, exp, boundary, idx)
+		}
+	}
+}
+
+func TestMemoryBytes(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20, 30})
+	before := bin.MemoryBytes()
+
+	// One count per bin number and one count of hits per boundary
+	bin.Accumulate(5)
+	if out := bin.MemoryBytes(); out != before+8*(5+4) {
+		t.Errorf("Expected accumulating to add %d bytes but got %d", 8*(5+4), out-before)
+	}
+
+	fast, _ := NewFast([]float64{0, 10, 20, 30})
+	if fast.MemoryBytes() <= before {
+		t.Errorf("Expected the fast lookup table to take additional memory")
+	}
+
+	// Each label takes a string header in the labels array plus its bytes
+	before = bin.MemoryBytes()
+	bin.SetLabels([]string{"", "a", "bb", "ccc", ""})
+	if exp := 5*2*strconv.IntSize/8 + 6; bin.MemoryBytes() != before+exp {
+		t.Errorf("Expected labels to add %d bytes but got %d", exp, bin.MemoryBytes()-before)
+	}
+}
+
+func TestSearchHint(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	boundaries := randomBoundaries(rng, 50)
+	lo, hi := boundaries[0], boundaries[len(boundaries)-1]
+
+	plain, _ := New(boundaries)
+	epsilon, _ := NewWithOptions(boundaries, Options{OpenEnded: true, Epsilon: 1e-6})
+	for _, bin := range []*Bin{plain, epsilon} {
+		for i := 0; i < 1000; i++ {
+			v := lo + (rng.Float64()*1.2-0.1)*(hi-lo)
+			exp := bin.Search(v)
+			for _, hint := range []int{exp, exp - 1, exp + 1, exp + 2, -7, 0, len(boundaries), 1 << 30} {
+				if out := bin.SearchHint(v, hint); out != exp {
+					t.Fatalf("Expected %g with hint %d to be binned to %d but got %d", v, hint, exp, out)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSearchHint(b *testing.B) {
+	bin, values := benchmarkData(b.N)
+	sort.Float64s(values)
+	b.ResetTimer()
+	n := 0
+	for _, v := range values {
+		n = bin.SearchHint(v, n)
+	}
+}
+
+func TestSearchApprox(t *testing.T) {
+	//                    0   1   2   3   4   5   6   7
+	bin, _ := New([]float64{2, 11, 19, 20, 21, 27, 29, 30})
+
+	// The uniform bin [18, 22) starts in bin 2 and holds three boundaries
+	testData := map[float64]int{
+		-4:   0,
+		3:    1,
+		12:   1,
+		18.5: 2,
+		21.5: 2,
+		23:   5,
+		29.5: 5,
+		30:   8,
+	}
+	for data, exp := range testData {
+		if out := bin.SearchApprox(data); out != exp {
+			t.Errorf("Expected %f to be approximately binned to %d but got %d", data, exp, out)
+		}
+	}
+
+	maxError, misbinned := bin.ApproxError([]float64{3, 12, 18.5, 21.5, 23, 29.5})
+	if maxError != 3 || misbinned != 3 {
+		t.Errorf("Expected a max error of 3 with 3 misbinned values but got %d and %d", maxError, misbinned)
+	}
+
+	// Uniform boundaries are binned exactly
+	uniform, _ := New([]float64{0, 1, 2, 3, 4})
+	if maxError, _ := uniform.ApproxError([]float64{-1, 0, 0.5, 1, 2.5, 3.999, 4, 9}); maxError != 0 {
+		t.Errorf("Expected no error for uniform boundaries but got %d", maxError)
+	}
+
+	// Measuring must not count clamped values
+	clamped, _ := NewWithOptions([]float64{2, 11, 19, 20, 21, 27, 29, 30}, Options{Clamp: true})
+	if maxError, misbinned := clamped.ApproxError([]float64{-4, 3, 12, 18.5, 21.5, 23, 29.5, 30}); maxError != 3 || misbinned != 3 {
+		t.Errorf("Expected a max error of 3 with 3 misbinned values but got %d and %d", maxError, misbinned)
+	}
+	if out := clamped.ClampedCount(); out != 0 {
+		t.Errorf("Expected ApproxError not to count clamped values but got %d", out)
+	}
+}
+
+func TestSearchRange(t *testing.T) {
+	bin, _ := New([]float64{2, 11, 19, 20})
+
+	testData := []struct {
+		a, b        float64
+		first, last int
+	}{
+		{3, 5, 1, 1},
+		{3, 11, 1, 1}, // 11 itself is not in [3, 11)
+		{3, 11.5, 1, 2},
+		{-5, 100, 0, 4},
+		{-5, 2, 0, 0},
+		{19, 19, 3, 3},
+		{20, math.Inf(1), 4, 4},
+	}
+	for _, d := range testData {
+		first, last, err := bin.SearchRange(d.a, d.b)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if first != d.first || last != d.last {
+			t.Errorf("Expected [%f, %f) to span bins %d to %d but got %d to %d", d.a, d.b, d.first, d.last, first, last)
+		}
+	}
+
+	if _, _, err := bin.SearchRange(5, 3); err == nil {
+		t.Errorf("Expected an error for a > b")
+	}
+	if _, _, err := bin.SearchRange(math.NaN(), 3); !errors.Is(err, ErrNaN) {
+		t.Errorf("Expected ErrNaN but got %v", err)
+	}
+}
+
+func TestSignedZero(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+
+	for _, boundaries := range [][]float64{
+		{-1, 0, 1},
+		{-1, negZero, 1},
+		{0, 1, 2},
+		{negZero, 1, 2},
+		{-2, -1, 0},
+		{-2, -1, negZero},
+	} {
+		bin, err := New(boundaries)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %s", boundaries, err)
+		}
+		if pos, neg := bin.Search(0), bin.Search(negZero); pos != neg {
+			t.Errorf("Expected 0 and -0 to share a bin in %v but got %d and %d", boundaries, pos, neg)
+		}
+		if pos, neg := bin.LinearSearch(0), bin.LinearSearch(negZero); pos != neg {
+			t.Errorf("Expected LinearSearch to bin 0 and -0 alike in %v but got %d and %d", boundaries, pos, neg)
+		}
+	}
+
+	if _, err := New([]float64{-1, negZero, 0, 1}); err == nil {
+		t.Errorf("Expected -0 and 0 to be duplicate boundaries")
+	}
+}
+
+func TestBranchStats(t *testing.T) {
+	//                    0   1   2   3   4   5   6   7
+	boundaries := []float64{2, 11, 19, 20, 21, 27, 29, 30}
+	bin, _ := NewWithOptions(boundaries, Options{CollectBranchStats: true})
+
+	// Uniform bins of width 4 hold 0, 0, 1, 0, 3, 0 and 2 boundaries
+	for _, v := range []float64{3, 7, 12, 15, 19.5, 20.5, 23, 28, 1, 31} {
+		bin.Search(v)
+	}
+	if h0, h1, h2, fallback := bin.BranchStats(); h0 != 4 || h1 != 1 || h2 != 1 || fallback != 2 {
+		t.Errorf("Expected branch stats 4, 1, 1, 2 but got %d, %d, %d, %d", h0, h1, h2, fallback)
+	}
+
+	plain, _ := New(boundaries)
+	plain.Search(20)
+	if h0, h1, h2, fallback := plain.BranchStats(); h0+h1+h2+fallback != 0 {
+		t.Errorf("Expected no branch stats without CollectBranchStats")
+	}
+}
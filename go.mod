@@ -1,3 +1,7 @@
 module github.com/wchresta/fastbinning
 
-go 1.16
+go 1.23
+
+require github.com/fsnotify/fsnotify v1.9.0
+
+require golang.org/x/sys v0.13.0 // indirect
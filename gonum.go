@@ -0,0 +1,37 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+// Adapters for gonum.org/v1/gonum/stat. stat.Histogram takes dividers that
+// correspond one to one to boundaries: both are sorted and both use
+// half-open bins [d[i], d[i+1]). Gonum's count[i] is therefore the count of
+// bin number i+1 here. Gonum has no underflow or overflow and requires all
+// values to lie within [d[0], d[len(d)-1]); values that would land in bin 0
+// or len(boundaries) here are outside of gonum's histogram.
+
+// ToGonumDividers returns the boundaries as dividers for gonum's
+// stat.Histogram. The slice is a copy.
+func (bin *Bin) ToGonumDividers() []float64 {
+	return bin.Boundaries()
+}
+
+// NewFromGonumDividers creates a Bin from dividers as used by gonum's
+// stat.Histogram. Like the boundaries for New, the dividers must be finite
+// and strictly increasing.
+func NewFromGonumDividers(dividers []float64) (*Bin, error) {
+	return New(dividers)
+}
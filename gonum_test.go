@@ -0,0 +1,37 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import "testing"
+
+func TestGonumDividers(t *testing.T) {
+	dividers := []float64{0, 1, 2.5, 4}
+	bin, err := NewFromGonumDividers(dividers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out := bin.ToGonumDividers(); !cmpFloatSlice(out, dividers) {
+		t.Errorf("Expected dividers %v but got %v", dividers, out)
+	}
+
+	// Gonum's count[i] covers [dividers[i], dividers[i+1]), which is bin i+1
+	for i := 0; i+1 < len(dividers); i++ {
+		if out := bin.Search(dividers[i]); out != i+1 {
+			t.Errorf("Expected divider %f to start bin %d but got %d", dividers[i], i+1, out)
+		}
+	}
+}
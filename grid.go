@@ -0,0 +1,108 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import "fmt"
+
+// Bin2D bins points in the plane into a grid of cells using one Bin per
+// axis
+type Bin2D struct {
+	x, y *Bin
+}
+
+// NewBin2D creates a Bin2D binning the first coordinate with x and the
+// second with y
+func NewBin2D(x, y *Bin) *Bin2D {
+	return &Bin2D{x: x, y: y}
+}
+
+// Search returns the bin numbers of x and y on their axes
+func (b *Bin2D) Search(x, y float64) (int, int) {
+	return b.x.Search(x), b.y.Search(y)
+}
+
+// SearchComplex bins z by its real part on the first and its imaginary part
+// on the second axis
+func (b *Bin2D) SearchComplex(z complex128) (int, int) {
+	return b.Search(real(z), imag(z))
+}
+
+// CountComplex counts zs per cell as binned by SearchComplex. The counts
+// are indexed by the bin number of the real part first, then of the
+// imaginary part.
+func (b *Bin2D) CountComplex(zs []complex128) [][]int {
+	counts := make([][]int, len(b.x.boundaries)+1)
+	for i := range counts {
+		counts[i] = make([]int, len(b.y.boundaries)+1)
+	}
+	for _, z := range zs {
+		i, j := b.SearchComplex(z)
+		counts[i][j]++
+	}
+	return counts
+}
+
+// GridBin bins points of any dimension into a grid of cells using one Bin
+// per axis
+type GridBin struct {
+	axes []*Bin
+}
+
+// NewGridBin creates a GridBin binning the i-th coordinate with axes[i]
+func NewGridBin(axes ...*Bin) *GridBin {
+	return &GridBin{axes: append([]*Bin(nil), axes...)}
+}
+
+// checkCoords panics if coords does not have one coordinate per axis
+func (g *GridBin) checkCoords(coords []float64) {
+	if len(coords) != len(g.axes) {
+		panic(fmt.Sprintf("need %d coordinates. Found %d", len(g.axes), len(coords)))
+	}
+}
+
+// Search returns the bin number of every coordinate on its axis
+func (g *GridBin) Search(coords []float64) []int {
+	g.checkCoords(coords)
+	bins := make([]int, len(coords))
+	for i, c := range coords {
+		bins[i] = g.axes[i].Search(c)
+	}
+	return bins
+}
+
+// FlatIndex returns the index of the cell coords lie in when the cells are
+// laid out in row-major order, with the last axis varying fastest. Every
+// axis contributes its underflow and overflow, so the indices range from 0
+// to Cells()-1.
+func (g *GridBin) FlatIndex(coords []float64) int {
+	g.checkCoords(coords)
+	idx := 0
+	for i, c := range coords {
+		idx = idx*(len(g.axes[i].boundaries)+1) + g.axes[i].Search(c)
+	}
+	return idx
+}
+
+// Cells returns the number of cells in the grid, including those formed by
+// the underflow and overflow of each axis
+func (g *GridBin) Cells() int {
+	cells := 1
+	for _, axis := range g.axes {
+		cells *= len(axis.boundaries) + 1
+	}
+	return cells
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import "testing"
+
+func TestBin2DComplex(t *testing.T) {
+	axis, _ := New([]float64{-1, 0, 1})
+	grid := NewBin2D(axis, axis)
+
+	if i, j := grid.SearchComplex(complex(0.5, -0.5)); i != 2 || j != 1 {
+		t.Errorf("Expected 0.5-0.5i to be binned to (2, 1) but got (%d, %d)", i, j)
+	}
+
+	// A QPSK constellation with one point out of range
+	counts := grid.CountComplex([]complex128{
+		complex(0.7, 0.7), complex(0.7, 0.7), complex(-0.7, 0.7),
+		complex(-0.7, -0.7), complex(0.7, -0.7), complex(2, 0.7),
+	})
+	expected := [][]int{
+		{0, 0, 0, 0},
+		{0, 1, 1, 0},
+		{0, 1, 2, 0},
+		{0, 0, 1, 0},
+	}
+	for i := range expected {
+		if !cmpIntSlice(counts[i], expected[i]) {
+			t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+			break
+		}
+	}
+}
+
+func TestGridBin(t *testing.T) {
+	x, _ := New([]float64{0, 1, 2})       // 4 bins
+	y, _ := New([]float64{0, 10, 20, 30}) // 5 bins
+	z, _ := New([]float64{-1, 1})         // 3 bins
+	grid := NewGridBin(x, y, z)
+
+	if cells := grid.Cells(); cells != 60 {
+		t.Errorf("Expected 60 cells but got %d", cells)
+	}
+
+	coords := []float64{1.5, 25, 5}
+	if bins := grid.Search(coords); !cmpIntSlice(bins, []int{2, 3, 2}) {
+		t.Errorf("Expected bins [2 3 2] but got %v", bins)
+	}
+	if idx := grid.FlatIndex(coords); idx != (2*5+3)*3+2 {
+		t.Errorf("Expected flat index %d but got %d", (2*5+3)*3+2, idx)
+	}
+	if idx := grid.FlatIndex([]float64{99, 99, 99}); idx != grid.Cells()-1 {
+		t.Errorf("Expected the last cell %d but got %d", grid.Cells()-1, idx)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic on the wrong number of coordinates")
+		}
+	}()
+	grid.Search([]float64{1, 2})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IntBin bins integers into bins given by integer boundaries. It uses the
+// same algorithm as Bin but does all arithmetic on integers, so values on a
+// boundary are never misbinned by rounding. Bin numbers are the same as for
+// Bin.Search.
+type IntBin struct {
+	boundaries          []int64 // must be monotonically increasing
+	uniformBinWidth     uint64
+	histogram           []int
+	cumulativeHistogram []int
+}
+
+// NewInt creates an IntBin from at least two strictly increasing
+// boundaries. The boundaries are copied.
+func NewInt(boundaries []int64) (*IntBin, error) {
+	if len(boundaries) < 2 {
+		return nil, fmt.Errorf("need at least 2 boundaries but got %d", len(boundaries))
+	}
+	for i, b := range boundaries[1:] {
+		if boundaries[i] >= b {
+			return nil, fmt.Errorf("boundaries must be monotonically sorted. Found %d >= %d at index %d and %d", boundaries[i], b, i, i+1)
+		}
+	}
+
+	bin := &IntBin{boundaries: append([]int64(nil), boundaries...)}
+	m := len(boundaries) - 1
+
+	// The difference of sorted int64s always fits into a uint64. Rounding
+	// the width up keeps the number of uniform bins at most m.
+	totalWidth := uint64(boundaries[m]) - uint64(boundaries[0])
+	bin.uniformBinWidth = totalWidth / uint64(m)
+	if totalWidth%uint64(m) != 0 {
+		bin.uniformBinWidth++
+	}
+	u := int((totalWidth-1)/bin.uniformBinWidth) + 1
+
+	bin.histogram = make([]int, u)
+	for _, b := range bin.boundaries[1:m] {
+		bin.histogram[bin.uniformBinNumber(b)-1]++
+	}
+	bin.cumulativeHistogram = make([]int, u+1)
+	bin.cumulativeHistogram[0] = 1
+	for i, h := range bin.histogram {
+		bin.cumulativeHistogram[i+1] = bin.cumulativeHistogram[i] + h
+	}
+	return bin, nil
+}
+
+// uniformBinNumber returns the uniform bin value lies in, given that it lies
+// within the boundaries. Integer division is exact, so no clamping is
+// needed.
+func (bin *IntBin) uniformBinNumber(value int64) int {
+	return int((uint64(value)-uint64(bin.boundaries[0]))/bin.uniformBinWidth) + 1
+}
+
+// Search returns the bin number of value as Bin.Search does: 0 left of the
+// first boundary, n for [Boundary(n-1), Boundary(n)) and len(boundaries)
+// at or right of the last boundary.
+func (bin *IntBin) Search(value int64) int {
+	if value < bin.boundaries[0] {
+		return 0
+	} else if value >= bin.boundaries[len(bin.boundaries)-1] {
+		return len(bin.boundaries)
+	}
+
+	k := bin.uniformBinNumber(value)
+	h, r := bin.histogram[k-1], bin.cumulativeHistogram[k-1]
+
+	// Only the h boundaries in the uniform bin can lie at or below value
+	switch h {
+	case 0:
+		return r
+	case 1:
+		if value >= bin.boundaries[r] {
+			return r + 1
+		}
+		return r
+	case 2:
+		if value >= bin.boundaries[r+1] {
+			return r + 2
+		} else if value < bin.boundaries[r] {
+			return r
+		}
+		return r + 1
+	default:
+		return r + sort.Search(h, func(i int) bool { return value < bin.boundaries[r+i] })
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestIntBin(t *testing.T) {
+	boundaries := []int64{2, 11, 19, 20, 21, 27, 29, 30}
+	bin, err := NewInt(boundaries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for v := int64(-5); v < 35; v++ {
+		exp := sort.Search(len(boundaries), func(i int) bool { return v < boundaries[i] })
+		if out := bin.Search(v); out != exp {
+			t.Errorf("Expected %d to be binned to %d but got %d", v, exp, out)
+		}
+	}
+
+	// Boundaries spanning the whole int64 range, where float64 loses
+	// precision
+	extreme := []int64{math.MinInt64, -1 << 62, 0, 1<<53 + 1, 1<<53 + 2, math.MaxInt64}
+	bin, err = NewInt(extreme)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	values := []int64{math.MinInt64, math.MaxInt64, 1 << 53, -1}
+	for _, b := range extreme {
+		values = append(values, b, b-1, b+1)
+	}
+	for i := 0; i < 1000; i++ {
+		values = append(values, int64(rng.Uint64()))
+	}
+	for _, v := range values {
+		exp := sort.Search(len(extreme), func(i int) bool { return v < extreme[i] })
+		if out := bin.Search(v); out != exp {
+			t.Errorf("Expected %d to be binned to %d but got %d", v, exp, out)
+		}
+	}
+
+	// Clustered boundaries put many boundaries into a single uniform bin
+	clustered := []int64{0, 1000}
+	for b := int64(500); b < 600; b += 3 {
+		clustered = append(clustered[:len(clustered)-1], b, 1000)
+	}
+	bin, err = NewInt(clustered)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for v := int64(-1); v <= 1001; v++ {
+		exp := sort.Search(len(clustered), func(i int) bool { return v < clustered[i] })
+		if out := bin.Search(v); out != exp {
+			t.Errorf("Expected %d to be binned to %d but got %d", v, exp, out)
+		}
+	}
+
+	for _, invalid := range [][]int64{nil, {1}, {1, 1}, {3, 2}} {
+		if _, err := NewInt(invalid); err == nil {
+			t.Errorf("Expected an error for %v", invalid)
+		}
+	}
+}
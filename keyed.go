@@ -0,0 +1,38 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+// KeyedBin bins items of any type by a float key derived from each item
+type KeyedBin[T any] struct {
+	bin *Bin
+	key func(T) float64
+}
+
+// NewKeyed creates a KeyedBin binning the keys of items with bin
+func NewKeyed[T any](bin *Bin, key func(T) float64) *KeyedBin[T] {
+	return &KeyedBin[T]{bin: bin, key: key}
+}
+
+// Search returns the bin number of the key of item
+func (kb *KeyedBin[T]) Search(item T) int {
+	return kb.bin.Search(kb.key(item))
+}
+
+// Bin returns the underlying Bin
+func (kb *KeyedBin[T]) Bin() *Bin {
+	return kb.bin
+}
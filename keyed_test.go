@@ -0,0 +1,44 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import "testing"
+
+func TestKeyedBin(t *testing.T) {
+	type order struct {
+		id    string
+		price float64
+	}
+
+	bin, _ := New([]float64{0, 10, 100})
+	kb := NewKeyed(bin, func(o order) float64 { return o.price })
+
+	testData := map[order]int{
+		{"refund", -5}:  0,
+		{"cheap", 9.99}: 1,
+		{"regular", 10}: 2,
+		{"luxury", 1e4}: 3,
+	}
+	for data, exp := range testData {
+		if out := kb.Search(data); out != exp {
+			t.Errorf("Expected %v to be binned to %d but got %d", data, exp, out)
+		}
+	}
+	if kb.Bin() != bin {
+		t.Errorf("Expected Bin to return the wrapped Bin")
+	}
+}
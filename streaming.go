@@ -0,0 +1,58 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import "sync"
+
+// StreamingCounter counts values per bin while they stream in, and can be
+// read at any time from other goroutines.
+type StreamingCounter struct {
+	bin *Bin
+
+	mu     sync.Mutex
+	counts []int64
+}
+
+// NewStreamingCounter creates a StreamingCounter for the bins of bin
+func NewStreamingCounter(bin *Bin) *StreamingCounter {
+	return &StreamingCounter{
+		bin:    bin,
+		counts: make([]int64, len(bin.boundaries)+1),
+	}
+}
+
+// Feed counts every value received on ch until ch is closed. It blocks, so
+// it is usually run in its own goroutine:
+//
+//	go counter.Feed(ch)
+//
+// Several Feeds may run concurrently.
+func (c *StreamingCounter) Feed(ch <-chan float64) {
+	for v := range ch {
+		n := c.bin.Search(v)
+		c.mu.Lock()
+		c.counts[n]++
+		c.mu.Unlock()
+	}
+}
+
+// Snapshot returns a copy of the current counts, indexed by bin number
+func (c *StreamingCounter) Snapshot() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int64(nil), c.counts...)
+}
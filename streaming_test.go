@@ -0,0 +1,51 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStreamingCounter(t *testing.T) {
+	bin, _ := New([]float64{0, 10, 20})
+	counter := NewStreamingCounter(bin)
+
+	ch := make(chan float64)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counter.Feed(ch)
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		ch <- float64(i%25) - 2
+		if i == 50 {
+			// Snapshots may be taken while values stream in
+			counter.Snapshot()
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	expected := []int64{8, 40, 40, 12}
+	if counts := counter.Snapshot(); !cmpInt64Slice(counts, expected) {
+		t.Errorf("Expected counts\n%v but got\n%v\n", expected, counts)
+	}
+}
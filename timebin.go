@@ -0,0 +1,67 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeBin bins points in time into windows given by time boundaries. It
+// works on a Bin of nanoseconds since the first boundary, which keeps full
+// precision for windows spanning up to about 104 days.
+type TimeBin struct {
+	bin    *Bin
+	origin time.Time
+}
+
+// NewTime creates a TimeBin from boundaries, which must be strictly
+// increasing. The monotonic clock readings of the boundaries are ignored,
+// so only their wall clock times matter.
+func NewTime(boundaries []time.Time) (*TimeBin, error) {
+	if len(boundaries) < 2 {
+		return nil, fmt.Errorf("need at least 2 time boundaries but got %d", len(boundaries))
+	}
+	origin := boundaries[0].Round(0)
+
+	floats := make([]float64, len(boundaries))
+	for i, t := range boundaries {
+		if i > 0 && !boundaries[i-1].Round(0).Before(t.Round(0)) {
+			return nil, fmt.Errorf("time boundaries must be monotonically sorted. Found %s >= %s at index %d and %d", boundaries[i-1], t, i-1, i)
+		}
+		floats[i] = nanosSince(t, origin)
+	}
+
+	bin, err := newBin(floats, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &TimeBin{bin: bin, origin: origin}, nil
+}
+
+// nanosSince returns the wall clock nanoseconds from origin to t. Unlike
+// t.Sub it ignores the monotonic clock reading and does not saturate for
+// times centuries apart.
+func nanosSince(t, origin time.Time) float64 {
+	t = t.Round(0)
+	return float64(t.Unix()-origin.Unix())*1e9 + float64(t.Nanosecond()-origin.Nanosecond())
+}
+
+// Search returns the bin number of t, numbered as by Bin.Search
+func (tb *TimeBin) Search(t time.Time) int {
+	return tb.bin.Search(nanosSince(t, tb.origin))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeBin(t *testing.T) {
+	// time.Now carries a monotonic clock reading, which must not matter
+	start := time.Now()
+	boundaries := []time.Time{
+		start,
+		start.Add(time.Minute),
+		start.Add(time.Hour),
+		start.Add(24 * time.Hour),
+	}
+	tb, err := NewTime(boundaries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	testData := map[time.Time]int{
+		start.Add(-time.Nanosecond):              0,
+		start.Round(0):                           1,
+		start.Add(time.Minute - time.Nanosecond): 1,
+		start.Add(time.Minute).Round(0):          2,
+		start.Add(2 * time.Hour):                 3,
+		start.Add(24 * time.Hour):                4,
+		start.AddDate(300, 0, 0):                 4,
+	}
+	for data, exp := range testData {
+		if out := tb.Search(data); out != exp {
+			t.Errorf("Expected %s to be binned to %d but got %d", data, exp, out)
+		}
+	}
+
+	if _, err := NewTime([]time.Time{start, start}); err == nil {
+		t.Errorf("Expected an error for equal time boundaries")
+	}
+	for _, boundaries := range [][]time.Time{nil, {start}} {
+		if _, err := NewTime(boundaries); err == nil || !strings.HasPrefix(err.Error(), "need at least 2 time boundaries") {
+			t.Errorf("Expected an error for %d time boundaries but got %v", len(boundaries), err)
+		}
+	}
+
+	// Boundaries centuries apart exceed what time.Duration can hold
+	wide, err := NewTime([]time.Time{
+		time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out := wide.Search(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)); out != 2 {
+		t.Errorf("Expected 2021 to be binned to 2 but got %d", out)
+	}
+}
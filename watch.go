@@ -0,0 +1,142 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fastbinning
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchedBin is a Bin whose boundaries are loaded from a file and reloaded
+// whenever the file changes. Reloads swap in a new Bin atomically, so
+// concurrent searches always see either the old or the new boundaries.
+//
+// Changes are detected with fsnotify on the directory of the file, so the
+// file is reloaded both when it is written and when another file is renamed
+// over it. A file written in several steps may be loaded halfway; writing a
+// temporary file and renaming it over the watched one avoids that. The file
+// holds boundaries separated by whitespace.
+type WatchedBin struct {
+	path    string
+	onError func(error)
+	current atomic.Pointer[Bin]
+
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatchedBin loads the boundaries in path and starts watching the file
+// for changes. Loading the initial boundaries must succeed. Failed reloads
+// keep the previous Bin and are reported to onError, which may be nil, as
+// are errors of the watcher. Call Close to stop watching.
+func NewWatchedBin(path string, onError func(error)) (*WatchedBin, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &WatchedBin{
+		path:    filepath.Clean(path),
+		onError: onError,
+		watcher: watcher,
+		done:    make(chan struct{}),
+	}
+
+	// Watch before the initial load so that no change in between is missed.
+	// Replacing the file by renaming ends a watch on the file itself, so we
+	// watch its directory instead.
+	if err := watcher.Add(filepath.Dir(w.path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	if err := w.reload(); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.watch()
+	return w, nil
+}
+
+// Bin returns the current Bin. It must not be modified.
+func (w *WatchedBin) Bin() *Bin {
+	return w.current.Load()
+}
+
+// Search returns the bin number of value in the current Bin
+func (w *WatchedBin) Search(value float64) int {
+	return w.current.Load().Search(value)
+}
+
+// Close stops watching the file. The current Bin stays usable.
+func (w *WatchedBin) Close() {
+	w.closeOnce.Do(func() { w.watcher.Close() })
+	<-w.done
+}
+
+func (w *WatchedBin) watch() {
+	defer close(w.done)
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// Removing the file keeps the current Bin until a new one is
+			// created
+			if filepath.Clean(event.Name) != w.path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if err := w.reload(); err != nil {
+				w.reportError(err)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.reportError(err)
+		}
+	}
+}
+
+func (w *WatchedBin) reportError(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// reload loads the file and swaps in the new Bin
+func (w *WatchedBin) reload() error {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	bin, err := NewFromReader(bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", w.path, err)
+	}
+
+	w.current.Store(bin)
+	return nil
+}
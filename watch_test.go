@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Wanja Chresta
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fastbinning
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchedBin(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "boundaries")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// replace swaps in content atomically like deployment tools do
+	replace := func(content string) {
+		tmp := filepath.Join(dir, "boundaries.tmp")
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	write("0 10 20\n")
+
+	errs := make(chan error, 10)
+	w, err := NewWatchedBin(path, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer w.Close()
+
+	if out := w.Search(15); out != 2 {
+		t.Errorf("Expected 15 to be binned to 2 but got %d", out)
+	}
+
+	write("0 5 10 15 20")
+	waitFor("reload after writing", func() bool { return w.Search(15) == 4 })
+
+	replace("0 15 20")
+	waitFor("reload after renaming", func() bool { return w.Search(15) == 2 })
+
+	replace("0 10 5")
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the reload error")
+	}
+	if out := w.Search(15); out != 2 {
+		t.Errorf("Expected invalid reload to keep the previous Bin but 15 binned to %d", out)
+	}
+
+	if _, err := NewWatchedBin(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+}